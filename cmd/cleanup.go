@@ -1,30 +1,31 @@
 package cmd
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"k8s-volume-mount/internal"
 )
 
-// CleanupCommand handles the unmount command execution
+// CleanupCommand handles the cleanup command execution
 func CleanupCommand(args []string) error {
 	// Parse command line flags
-	unmountCmd := flag.NewFlagSet("unmount", flag.ExitOnError)
-	pvcName := unmountCmd.String("pvc", "", "Name of the PersistentVolumeClaim")
-	err := unmountCmd.Parse(args)
+	cleanupCmd := flag.NewFlagSet("cleanup", flag.ExitOnError)
+	selection := addMountFlags(cleanupCmd)
+	remote := cleanupCmd.Bool("remote", false, "Delete the servers of the PVC in the cluster, also those without a local mount")
+	allClients := cleanupCmd.Bool("all-clients", false, "With -remote, also delete the servers of other users and hosts")
+	err := cleanupCmd.Parse(args)
 	if err != nil {
 		return fmt.Errorf("error parsing command line flags: %v", err)
 	}
 
-	// Validate arguments
-	if *pvcName == "" {
-		return fmt.Errorf("PVC name must be specified")
+	if *remote {
+		return cleanupRemote(selection, *allClients)
 	}
 
-	// metadata loaded from config - only pvcName is required
-	meta := internal.NewMetadata("", *pvcName, 0)
-	if meta.ProviderType == "" {
-		return fmt.Errorf("no mount information found for PVC: %s", *pvcName)
+	meta, err := selection.findMount()
+	if err != nil {
+		return err
 	}
 
 	p := internal.NewProviderFromMetadata(meta)
@@ -33,10 +34,68 @@ func CleanupCommand(args []string) error {
 	}
 
 	// Unmount and cleanup
-	fmt.Printf("Disconnecting volume %s...\n", *pvcName)
+	fmt.Printf("Disconnecting volume %s...\n", meta.Key())
 	if err := p.Cleanup(); err != nil {
 		return fmt.Errorf("error during cleanup: %v", err)
 	}
 
 	return nil
 }
+
+// cleanupRemote deletes the servers of a PVC found in the cluster, in all namespaces if none is given.
+// Servers mounted from this host are cleaned up like their local mount.
+func cleanupRemote(selection *mountFlags, allClients bool) error {
+	if *selection.pvcName == "" {
+		return fmt.Errorf("PVC name must be specified")
+	}
+	subPath, err := internal.NormalizeSubPath(*selection.subPath)
+	if err != nil {
+		return err
+	}
+
+	if err := resolveKubeOptions(selection.kubeOptions); err != nil {
+		return err
+	}
+	client, err := internal.NewKubeClient(*selection.kubeOptions)
+	if err != nil {
+		return fmt.Errorf("error connecting to cluster: %v", err)
+	}
+
+	servers, err := client.ListRemoteServers(*selection.namespace, *selection.pvcName, !allClients)
+	if err != nil {
+		return err
+	}
+	mounts, err := internal.FindMetadata("", "", client.Context)
+	if err != nil {
+		fmt.Printf("Warning: Error loading metadata: %v\n", err)
+	}
+
+	deleted := 0
+	var errs []error
+	for _, server := range servers {
+		if subPath != "" && server.SubPath != subPath {
+			continue
+		}
+		deleted++
+
+		if meta := server.FindMount(mounts, client.Context); meta != nil {
+			if p := internal.NewProviderFromMetadata(meta); p != nil {
+				fmt.Printf("Disconnecting volume %s...\n", meta.Key())
+				if err := p.Cleanup(); err != nil {
+					errs = append(errs, fmt.Errorf("error during cleanup of %s: %v", meta.Key(), err))
+				}
+				continue
+			}
+		}
+
+		fmt.Printf("Deleting server %s in namespace %s (created by %s)...\n", server.Name, server.Namespace, server.CreatedBy)
+		if err := client.DeleteServerResources(server.Name, server.Namespace); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if deleted == 0 {
+		fmt.Printf("No servers of PVC %s found\n", *selection.pvcName)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"k8s-volume-mount/internal"
+)
+
+// DaemonCommand runs the background daemon that supervises a mount, it is started by the mount and forward commands
+func DaemonCommand(args []string) error {
+	// Parse command line flags
+	daemonCmd := flag.NewFlagSet(internal.DaemonCommandName, flag.ExitOnError)
+	configPath := daemonCmd.String("config", "", "Path to the config file of the mount")
+	err := daemonCmd.Parse(args)
+	if err != nil {
+		return fmt.Errorf("error parsing command line flags: %v", err)
+	}
+
+	// Validate arguments
+	if *configPath == "" {
+		return fmt.Errorf("config file must be specified")
+	}
+
+	meta := internal.Metadata{}
+	if err := meta.Load(*configPath); err != nil {
+		return fmt.Errorf("error loading metadata: %v", err)
+	}
+
+	return internal.RunDaemon(&meta)
+}
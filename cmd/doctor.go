@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"k8s-volume-mount/internal"
+)
+
+// DoctorCommand handles the doctor command execution, it reports and optionally repairs leftovers of crashed mounts
+func DoctorCommand(args []string) error {
+	// Parse command line flags
+	doctorCmd := flag.NewFlagSet("doctor", flag.ExitOnError)
+	fix := doctorCmd.Bool("fix", false, "Repair the problems found")
+	kubeOptions := addKubeFlags(doctorCmd)
+	err := doctorCmd.Parse(args)
+	if err != nil {
+		return fmt.Errorf("error parsing command line flags: %v", err)
+	}
+
+	if err := resolveKubeOptions(kubeOptions); err != nil {
+		return err
+	}
+
+	fmt.Println("Checking mounts, mount table, processes and cluster...")
+	problems := internal.Diagnose(*kubeOptions)
+	if len(problems) == 0 {
+		fmt.Println("No problems found")
+		return nil
+	}
+
+	fmt.Printf("Found %d problems:\n", len(problems))
+	failed := 0
+	for _, problem := range problems {
+		fmt.Printf("  - %s\n", problem.Description)
+		if !*fix {
+			continue
+		}
+		if problem.Fix == nil {
+			fmt.Println("    Can't be repaired automatically")
+			failed++
+			continue
+		}
+		if err := problem.Fix(); err != nil {
+			fmt.Printf("    Error repairing: %v\n", err)
+			failed++
+			continue
+		}
+		fmt.Println("    Repaired")
+	}
+
+	if !*fix {
+		return fmt.Errorf("found %d problems, run doctor -fix to repair them", len(problems))
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d problems could not be repaired", failed, len(problems))
+	}
+	return nil
+}
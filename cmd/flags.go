@@ -0,0 +1,207 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"k8s-volume-mount/internal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// addKubeFlags registers the global flags selecting the cluster and identity on a command
+func addKubeFlags(flags *flag.FlagSet) *internal.KubeOptions {
+	options := &internal.KubeOptions{}
+	flags.StringVar(&options.Kubeconfig, "kubeconfig", "", "Path to the kubeconfig file (optional)")
+	flags.StringVar(&options.Context, "context", "", "Kubeconfig context (optional, default: current context)")
+	flags.StringVar(&options.As, "as", "", "Username to impersonate (optional)")
+	flags.Func("as-group", "Group to impersonate, can be repeated (optional)", func(value string) error {
+		options.AsGroups = append(options.AsGroups, value)
+		return nil
+	})
+	return options
+}
+
+// resolveKubeOptions makes the kubeconfig path absolute so that it stays valid when stored in metadata
+func resolveKubeOptions(options *internal.KubeOptions) error {
+	if options.Kubeconfig == "" {
+		return nil
+	}
+
+	path, err := filepath.Abs(options.Kubeconfig)
+	if err != nil {
+		return fmt.Errorf("error resolving kubeconfig path: %v", err)
+	}
+	options.Kubeconfig = path
+	return nil
+}
+
+// mountFlags are the flags selecting an existing mount
+type mountFlags struct {
+	pvcName     *string
+	namespace   *string
+	subPath     *string
+	kubeOptions *internal.KubeOptions
+}
+
+// addMountFlags registers the flags selecting an existing mount on a command
+func addMountFlags(flags *flag.FlagSet) *mountFlags {
+	return &mountFlags{
+		pvcName:     flags.String("pvc", "", "Name of the PersistentVolumeClaim"),
+		namespace:   flags.String("namespace", "", "Namespace, required if the PVC is mounted from several namespaces"),
+		subPath:     flags.String("sub-path", "", "Sub path, required if the PVC is mounted with several sub paths"),
+		kubeOptions: addKubeFlags(flags),
+	}
+}
+
+// findMount returns the metadata of the selected mount
+func (f *mountFlags) findMount() (*internal.Metadata, error) {
+	if *f.pvcName == "" {
+		return nil, fmt.Errorf("PVC name must be specified")
+	}
+
+	subPath, err := internal.NormalizeSubPath(*f.subPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mounts are identified by PVC name, namespace, context and sub path
+	meta, err := internal.FindSingleMetadata(*f.pvcName, *f.namespace, f.kubeOptions.Context, subPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mounts of former versions didn't record kubeconfig and identity, use the given flags
+	if err := resolveKubeOptions(f.kubeOptions); err != nil {
+		return nil, err
+	}
+	if meta.Kubeconfig == "" {
+		meta.Kubeconfig = f.kubeOptions.Kubeconfig
+	}
+	if meta.As == "" {
+		meta.As = f.kubeOptions.As
+		meta.AsGroups = f.kubeOptions.AsGroups
+	}
+
+	return meta, nil
+}
+
+// leaseFlags are the flags making the server expire
+type leaseFlags struct {
+	ttl         *time.Duration
+	idleTimeout *time.Duration
+}
+
+// addLeaseFlags registers the flags making the server expire on a command
+func addLeaseFlags(flags *flag.FlagSet) *leaseFlags {
+	return &leaseFlags{
+		ttl:         flags.Duration("ttl", 0, "Remove the server after this duration unless it is renewed, e.g. 8h (optional)"),
+		idleTimeout: flags.Duration("idle-timeout", 0, "Remove the server if no client connected for this duration, e.g. 30m (optional)"),
+	}
+}
+
+// apply validates the flags and records the lifetime of the server in the metadata
+func (f *leaseFlags) apply(meta *internal.Metadata) error {
+	if *f.ttl < 0 || *f.idleTimeout < 0 {
+		return fmt.Errorf("error: -ttl and -idle-timeout must be positive")
+	}
+	if (*f.ttl > 0 || *f.idleTimeout > 0) && meta.AttachPod != "" {
+		return fmt.Errorf("error: -ttl and -idle-timeout can't be used with -attach, ephemeral containers can't be removed")
+	}
+
+	meta.TTL = *f.ttl
+	if meta.TTL > 0 {
+		meta.ExpiresAt = time.Now().Add(meta.TTL)
+	}
+	meta.IdleTimeout = *f.idleTimeout
+	return nil
+}
+
+// resolveAttachPod returns the pod the server is injected into, or an empty string to create a deployment
+func resolveAttachPod(client *internal.KubeClient, attach bool, attachPod string, pvcName string, namespace string) (string, error) {
+	if attachPod != "" || !attach {
+		return attachPod, nil
+	}
+
+	pod, err := client.FindPVCPod(pvcName, namespace)
+	if err != nil {
+		return "", fmt.Errorf("error finding a pod that mounts PVC %s: %v", pvcName, err)
+	}
+	return pod.Name, nil
+}
+
+// podFlags are the flags customizing the pod running the server
+type podFlags struct {
+	configFile string
+	overrides  internal.PodOptions
+}
+
+// addPodFlags registers the flags customizing the pod running the server on a command
+func addPodFlags(flags *flag.FlagSet) *podFlags {
+	pf := &podFlags{}
+	options := &pf.overrides
+	flags.StringVar(&pf.configFile, "pod-config", "", "File with pod options (optional, default: "+internal.PodConfigFile+" if it exists)")
+	flags.StringVar(&options.Image, "image", "", "Image of the server (optional, default: "+internal.DefaultImage+")")
+	flags.Func("image-pull-secret", "Image pull secret, can be repeated (optional)", func(value string) error {
+		options.ImagePullSecrets = append(options.ImagePullSecrets, value)
+		return nil
+	})
+	flags.Func("requests", "Resource requests, e.g. cpu=100m,memory=128Mi (optional)", func(value string) error {
+		resources, err := internal.ParseResourceList(value)
+		options.Resources.Requests = resources
+		return err
+	})
+	flags.Func("limits", "Resource limits, e.g. cpu=1,memory=512Mi (optional)", func(value string) error {
+		resources, err := internal.ParseResourceList(value)
+		options.Resources.Limits = resources
+		return err
+	})
+	flags.Func("toleration", "Toleration in the format KEY[=VALUE][:EFFECT], can be repeated (optional)", func(value string) error {
+		toleration, err := internal.ParseToleration(value)
+		options.Tolerations = append(options.Tolerations, toleration)
+		return err
+	})
+	flags.Func("node-selector", "Node selector in the format KEY=VALUE, can be repeated (optional)", func(value string) error {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("expected KEY=VALUE")
+		}
+		if options.NodeSelector == nil {
+			options.NodeSelector = map[string]string{}
+		}
+		options.NodeSelector[key] = val
+		return nil
+	})
+	flags.Func("run-as-user", "User ID the server runs as (optional)", parseIDFlag(&options.RunAsUser))
+	flags.Func("run-as-group", "Group ID the server runs as (optional)", parseIDFlag(&options.RunAsGroup))
+	flags.Func("fs-group", "Supplemental group applied to the volume (optional)", parseIDFlag(&options.FSGroup))
+	return pf
+}
+
+// parseIDFlag returns a flag parser for a user or group ID
+func parseIDFlag(target **int64) func(string) error {
+	return func(value string) error {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || id < 0 {
+			return fmt.Errorf("invalid ID %s", value)
+		}
+		*target = &id
+		return nil
+	}
+}
+
+// resolvePodOptions reads the pod config file and applies the flags on top of it
+func resolvePodOptions(pf *podFlags) (internal.PodOptions, error) {
+	path, required := pf.configFile, true
+	if path == "" {
+		path, required = internal.PodConfigFile, false
+	}
+
+	options, err := internal.LoadPodOptions(path, required)
+	if err != nil {
+		return options, err
+	}
+	options.Merge(pf.overrides)
+	return options, nil
+}
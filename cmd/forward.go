@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"k8s-volume-mount/internal"
+	"os"
+	"strings"
 )
 
 // ForwardCommand handles the forward-port command execution
@@ -12,8 +15,18 @@ func ForwardCommand(args []string) error {
 	forwardCmd := flag.NewFlagSet("forward", flag.ExitOnError)
 	pvcName := forwardCmd.String("pvc", "", "Name of the PersistentVolumeClaim")
 	port := forwardCmd.Int("port", 0, "Specific port for port forwarding (optional)")
-	providerType := forwardCmd.String("provider", "webdav", "Provider type: webdav")
+	providerType := forwardCmd.String("provider", "webdav", "Provider type: "+strings.Join(internal.ProviderNames(false), ", "))
 	namespace := forwardCmd.String("namespace", "", "Namespace (optional)")
+	kubeOptions := addKubeFlags(forwardCmd)
+	podFlags := addPodFlags(forwardCmd)
+	lease := addLeaseFlags(forwardCmd)
+	attach := forwardCmd.Bool("attach", false, "Inject the server into a running pod that mounts the PVC instead of creating a deployment")
+	subPath := forwardCmd.String("sub-path", "", "Only serve this directory of the volume (optional)")
+	useTLS := forwardCmd.Bool("tls", true, "Serve over TLS with a certificate generated for the mount (webdav, s3 and http only)")
+	sftpAuth := forwardCmd.String("sftp-auth", internal.SFTPAuthPassword, "SFTP authentication: password, key (generated key pair) or agent (keys of the ssh-agent)")
+	networkPolicy := forwardCmd.Bool("network-policy", true, "Deny all network traffic to the server pod, port forwarding is not affected")
+	readOnly := forwardCmd.Bool("read-only", false, "Serve and mount the volume read-only")
+	attachPod := forwardCmd.String("attach-pod", "", "Inject the server into this pod (optional, implies -attach)")
 	err := forwardCmd.Parse(args)
 	if err != nil {
 		return fmt.Errorf("error parsing command line flags: %v", err)
@@ -24,10 +37,44 @@ func ForwardCommand(args []string) error {
 		return fmt.Errorf("error: PVC name must be specified")
 	}
 
+	*subPath, err = internal.NormalizeSubPath(*subPath)
+	if err != nil {
+		return fmt.Errorf("error: %v", err)
+	}
+	if err := internal.ValidateSFTPAuth(*sftpAuth); err != nil {
+		return fmt.Errorf("error: %v", err)
+	}
+
+	if err := resolveKubeOptions(kubeOptions); err != nil {
+		return err
+	}
+
+	podOptions, err := resolvePodOptions(podFlags)
+	if err != nil {
+		return err
+	}
+
 	// Check if PVC exists
-	exists := internal.CheckPVCExists(*pvcName, *namespace)
-	if !exists {
-		return fmt.Errorf("error: PVC %s does not exist", *pvcName)
+	client, err := internal.NewKubeClient(*kubeOptions)
+	if err != nil {
+		return fmt.Errorf("error connecting to cluster: %v", err)
+	}
+	if err := client.CheckPVCExists(*pvcName, *namespace); err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			return fmt.Errorf("error: PVC %s does not exist", *pvcName)
+		}
+		return fmt.Errorf("error checking PVC %s: %v", *pvcName, err)
+	}
+
+	// Mounts are identified by context, namespace, PVC name and sub path
+	if *namespace == "" {
+		*namespace = client.Namespace
+	}
+	key := internal.SessionKey{Context: client.Context, Namespace: *namespace, PVCName: *pvcName, SubPath: *subPath}
+
+	attachPodName, err := resolveAttachPod(client, *attach, *attachPod, *pvcName, *namespace)
+	if err != nil {
+		return err
 	}
 
 	// Determine port
@@ -39,8 +86,24 @@ func ForwardCommand(args []string) error {
 		}
 	}
 
-	meta := internal.NewMetadata(*providerType, *pvcName, selectedPort)
-	meta.Namespace = *namespace
+	meta := internal.NewMetadata(*providerType, key, selectedPort)
+	meta.KubeOptions = *kubeOptions
+	meta.AttachPod = attachPodName
+	meta.ReadOnly = *readOnly
+	meta.TLS = *useTLS
+	meta.NetworkPolicy = *networkPolicy
+	meta.SFTPAuth = *sftpAuth
+	meta.Pod = podOptions
+	// Record the resolved context, later commands must not depend on the current context
+	meta.Context = client.Context
+	if err := lease.apply(meta); err != nil {
+		return err
+	}
+
+	// Check if the PVC is already mounted or forwarded
+	if _, err := os.Stat(meta.ConfigDir); err == nil {
+		return fmt.Errorf("PVC %s is already mounted or forwarded", key)
+	}
 
 	provider := internal.NewProviderFromMetadata(meta)
 	if provider == nil {
@@ -56,13 +119,24 @@ func ForwardCommand(args []string) error {
 	fmt.Printf("Volume %s available at port %d via %s server\n", *pvcName, meta.LocalPort, provider.Name())
 	fmt.Printf("k8s-volume-mount config file: %s\n", meta.GetConfigFilePath())
 
-	rcloneMounter := internal.NewRcloneMounter(meta)
-	confPath, err := rcloneMounter.WriteRcloneConfig()
-	if err != nil {
-		return fmt.Errorf("error generating rclone config: %v", err)
+	definition := internal.LookupProvider(meta.ProviderType)
+	if definition.RcloneConfig != nil {
+		rcloneMounter := internal.NewRcloneMounter(meta)
+		confPath, err := rcloneMounter.WriteRcloneConfig()
+		if err != nil {
+			return fmt.Errorf("error generating rclone config: %v", err)
+		}
+		fmt.Printf("rclone config file: %s\n", confPath)
 	}
 
-	fmt.Printf("rclone config file: %s\n", confPath)
+	if meta.TLS {
+		fmt.Printf("CA certificate of the server: %s\n", meta.GetCACertFilePath())
+	}
+	if definition.PrintEndpoint != nil {
+		if err := definition.PrintEndpoint(meta); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
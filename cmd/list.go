@@ -5,59 +5,86 @@ import (
 	"fmt"
 	"k8s-volume-mount/internal"
 	"os"
-	"path/filepath"
-	"strings"
+	"time"
 )
 
 // ListCommand handles the list command execution
 func ListCommand(args []string) error {
 	// Parse command line flags (no flags for list command currently)
 	listCmd := flag.NewFlagSet("list", flag.ExitOnError)
+	pvcName := listCmd.String("pvc", "", "Only list mounts of this PVC (optional)")
+	namespace := listCmd.String("namespace", "", "Only list mounts from this namespace (optional)")
+	remote := listCmd.Bool("remote", false, "List the servers in the cluster, also those of other users and hosts")
+	kubeOptions := addKubeFlags(listCmd)
 	err := listCmd.Parse(args)
 	if err != nil {
 		return fmt.Errorf("error parsing command line flags: %v", err)
 	}
 
+	if *remote {
+		return listRemote(*pvcName, *namespace, kubeOptions)
+	}
+
 	fmt.Println("Mounted Kubernetes Volumes:")
 	fmt.Println("---------------------------")
 
-	// Check if temp directory exists
-	if _, err := os.Stat(internal.TempDir); os.IsNotExist(err) {
-		fmt.Println("No mounted volumes found")
-		return nil
-	}
-
 	// Read all mount files
-	configFiles, err := filepath.Glob(filepath.Join(internal.TempDir, "**/config.json"))
-	if err != nil {
-		return fmt.Errorf("error reading mount information: %v", err)
-	}
-
-	if len(configFiles) == 0 {
+	mounts, loadErr := internal.FindMetadata(*pvcName, *namespace, kubeOptions.Context)
+	if len(mounts) == 0 {
 		fmt.Println("No mounted volumes found")
-		return nil
 	}
 
-	// Process each mount file
-	var errors []string
-	for _, mountFile := range configFiles {
-		meta := internal.Metadata{}
-		if err := meta.Load(mountFile); err != nil {
-			errors = append(errors, fmt.Sprintf("Error loading metadata from %s: %v", mountFile, err))
-			continue
-		}
-
+	// Process each mount
+	for _, meta := range mounts {
 		mountDir := meta.GetMountDir()
 
 		// Display volume information
 		fmt.Printf("PVC: %s\n", meta.PVCName)
+		fmt.Printf("  Context: %s\n", meta.Context)
+		fmt.Printf("  Namespace: %s\n", meta.Namespace)
+		if meta.SubPath != "" {
+			fmt.Printf("  Sub Path: %s\n", meta.SubPath)
+		}
 		fmt.Printf("  Mount Directory: %s\n", mountDir)
 		fmt.Printf("  Provider: %s\n", meta.ProviderType)
 		fmt.Printf("  Mount Method: %s\n", meta.MountMethod)
 		fmt.Printf("  LocalPort: %d\n", meta.LocalPort)
+		fmt.Printf("  Read-Only: %t\n", meta.ReadOnly)
+		if definition := internal.LookupProvider(meta.ProviderType); definition != nil && definition.Endpoint != nil {
+			fmt.Printf("  Endpoint: %s\n", definition.Endpoint(meta))
+		}
+		if meta.AttachPod != "" {
+			fmt.Printf("  Attached To: pod %s (container %s)\n", meta.AttachPod, meta.AttachContainer)
+		}
+		if meta.TTL > 0 {
+			fmt.Printf("  Expires: %s, renew to extend\n", formatExpiry(meta.ExpiresAt))
+		}
+		if meta.IdleTimeout > 0 {
+			fmt.Printf("  Idle Timeout: %s (renewed while the volume is used)\n", meta.IdleTimeout)
+		}
+
+		// Show events recorded by the mount daemon
+		events, err := meta.LoadEvents()
+		if err == nil && len(events) > 0 {
+			reconnects := 0
+			for _, event := range events {
+				if event.Type == internal.EventReconnected || event.Type == internal.EventRemounted {
+					reconnects++
+				}
+			}
+			last := events[len(events)-1]
+			fmt.Printf("  Reconnects: %d\n", reconnects)
+			fmt.Printf("  Last Event: %s %s (%s)\n", last.Time.Format(time.RFC3339), last.Type, last.Message)
+		}
 
-		// Check if volume is still accessible
-		if _, err := os.Stat(mountDir); os.IsNotExist(err) {
+		// Check if volume is still accessible, forwarded volumes aren't mounted
+		if meta.MountMethod == "" && !internal.IsProcessAlive(meta.PortForwardingPid) {
+			fmt.Printf("  Status: Disconnected, the server is kept (remount to reconnect)\n")
+		} else if meta.MountMethod == "" && meta.Unmounted {
+			fmt.Printf("  Status: Forwarded, unmounted (remount to mount again)\n")
+		} else if meta.MountMethod == "" {
+			fmt.Printf("  Status: Forwarded, not mounted\n")
+		} else if _, err := os.Stat(mountDir); os.IsNotExist(err) {
 			fmt.Printf("  Status: Mount directory not found\n")
 		} else {
 			// Try to read directory to check if mount is still active
@@ -71,10 +98,78 @@ func ListCommand(args []string) error {
 		fmt.Println("---------------------------")
 	}
 
-	if len(errors) > 0 {
-		fullErr := fmt.Sprintf("Errors loading metadata: %s", strings.Join(errors, "\n"))
-		return fmt.Errorf(fullErr)
+	if loadErr != nil {
+		return fmt.Errorf("errors loading metadata: %v", loadErr)
+	}
+
+	return nil
+}
+
+// listRemote lists the servers created by this tool in the cluster, in all namespaces if none is given
+func listRemote(pvcName string, namespace string, kubeOptions *internal.KubeOptions) error {
+	if err := resolveKubeOptions(kubeOptions); err != nil {
+		return err
+	}
+	client, err := internal.NewKubeClient(*kubeOptions)
+	if err != nil {
+		return fmt.Errorf("error connecting to cluster: %v", err)
+	}
+
+	servers, err := client.ListRemoteServers(namespace, pvcName, false)
+	if err != nil {
+		return err
+	}
+	mounts, loadErr := internal.FindMetadata("", "", client.Context)
+
+	fmt.Printf("Servers in context %s:\n", client.Context)
+	fmt.Println("---------------------------")
+	if len(servers) == 0 {
+		fmt.Println("No servers found")
 	}
 
+	for _, server := range servers {
+		fmt.Printf("Server: %s\n", server.Name)
+		fmt.Printf("  Namespace: %s\n", server.Namespace)
+		fmt.Printf("  PVC: %s\n", server.PVCName)
+		if server.SubPath != "" {
+			fmt.Printf("  Sub Path: %s\n", server.SubPath)
+		}
+		fmt.Printf("  Provider: %s\n", server.Provider)
+		fmt.Printf("  Created By: %s\n", server.CreatedBy)
+		fmt.Printf("  Created At: %s (%s ago)\n", server.CreatedAt.Format(time.RFC3339), time.Since(server.CreatedAt).Round(time.Minute))
+		if !server.ExpiresAt.IsZero() {
+			fmt.Printf("  Expires: %s\n", formatExpiry(server.ExpiresAt))
+		}
+		if server.Version != "" {
+			fmt.Printf("  Version: %s\n", server.Version)
+		}
+		if server.Ready {
+			fmt.Printf("  Status: Ready\n")
+		} else {
+			fmt.Printf("  Status: Not ready\n")
+		}
+
+		if meta := server.FindMount(mounts, client.Context); meta != nil {
+			fmt.Printf("  Local Mount: %s\n", meta.GetMountDir())
+		} else if server.IsOwn() {
+			fmt.Printf("  Local Mount: none, orphaned (cleanup -remote or doctor -fix to delete)\n")
+		} else {
+			fmt.Printf("  Local Mount: none, created on another host\n")
+		}
+		fmt.Println("---------------------------")
+	}
+
+	if loadErr != nil {
+		return fmt.Errorf("errors loading metadata: %v", loadErr)
+	}
 	return nil
 }
+
+// formatExpiry formats the expiry of a server with the remaining time
+func formatExpiry(expiresAt time.Time) string {
+	remaining := time.Until(expiresAt).Round(time.Minute)
+	if remaining <= 0 {
+		return fmt.Sprintf("%s (expired)", expiresAt.Local().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%s (in %s)", expiresAt.Local().Format(time.RFC3339), remaining)
+}
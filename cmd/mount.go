@@ -2,10 +2,12 @@ package cmd
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"k8s-volume-mount/internal"
 	"os"
+	"strings"
 )
 
 // MountCommand handles the mount command execution
@@ -14,8 +16,18 @@ func MountCommand(args []string) error {
 	mountCmd := flag.NewFlagSet("mount", flag.ExitOnError)
 	pvcName := mountCmd.String("pvc", "", "Name of the PersistentVolumeClaim")
 	port := mountCmd.Int("port", 0, "Specific port for port forwarding (optional)")
-	providerType := mountCmd.String("provider", "webdav", "Provider type: webdav")
+	providerType := mountCmd.String("provider", "webdav", "Provider type: "+strings.Join(internal.ProviderNames(true), ", "))
 	namespace := mountCmd.String("namespace", "", "Namespace (optional)")
+	kubeOptions := addKubeFlags(mountCmd)
+	podFlags := addPodFlags(mountCmd)
+	lease := addLeaseFlags(mountCmd)
+	attach := mountCmd.Bool("attach", false, "Inject the server into a running pod that mounts the PVC instead of creating a deployment")
+	subPath := mountCmd.String("sub-path", "", "Only serve this directory of the volume (optional)")
+	useTLS := mountCmd.Bool("tls", true, "Serve over TLS with a certificate generated for the mount (webdav, s3 and http only)")
+	sftpAuth := mountCmd.String("sftp-auth", internal.SFTPAuthPassword, "SFTP authentication: password, key (generated key pair) or agent (keys of the ssh-agent)")
+	networkPolicy := mountCmd.Bool("network-policy", true, "Deny all network traffic to the server pod, port forwarding is not affected")
+	readOnly := mountCmd.Bool("read-only", false, "Serve and mount the volume read-only")
+	attachPod := mountCmd.String("attach-pod", "", "Inject the server into this pod (optional, implies -attach)")
 	pauseOnError := mountCmd.Bool("pause-on-error", false, "Wait for user input on error before cleanup")
 	mountDir := mountCmd.String("mount-dir", "", "Mount directory (optional, default: ~/k8s-mounts)")
 	err := mountCmd.Parse(args)
@@ -27,11 +39,52 @@ func MountCommand(args []string) error {
 	if *pvcName == "" {
 		return fmt.Errorf("error: PVC name must be specified")
 	}
+	definition := internal.LookupProvider(*providerType)
+	if definition == nil {
+		return fmt.Errorf("error: unknown provider type %s", *providerType)
+	}
+	if !definition.Mountable() {
+		return fmt.Errorf("error: the %s provider can't be mounted, use forward to access the volume", *providerType)
+	}
+
+	*subPath, err = internal.NormalizeSubPath(*subPath)
+	if err != nil {
+		return fmt.Errorf("error: %v", err)
+	}
+	if err := internal.ValidateSFTPAuth(*sftpAuth); err != nil {
+		return fmt.Errorf("error: %v", err)
+	}
+
+	if err := resolveKubeOptions(kubeOptions); err != nil {
+		return err
+	}
+
+	podOptions, err := resolvePodOptions(podFlags)
+	if err != nil {
+		return err
+	}
 
 	// Check if PVC exists
-	exists := internal.CheckPVCExists(*pvcName, *namespace)
-	if !exists {
-		return fmt.Errorf("error: PVC %s does not exist", *pvcName)
+	client, err := internal.NewKubeClient(*kubeOptions)
+	if err != nil {
+		return fmt.Errorf("error connecting to cluster: %v", err)
+	}
+	if err := client.CheckPVCExists(*pvcName, *namespace); err != nil {
+		if errors.Is(err, internal.ErrNotFound) {
+			return fmt.Errorf("error: PVC %s does not exist", *pvcName)
+		}
+		return fmt.Errorf("error checking PVC %s: %v", *pvcName, err)
+	}
+
+	// Mounts are identified by context, namespace, PVC name and sub path
+	if *namespace == "" {
+		*namespace = client.Namespace
+	}
+	key := internal.SessionKey{Context: client.Context, Namespace: *namespace, PVCName: *pvcName, SubPath: *subPath}
+
+	attachPodName, err := resolveAttachPod(client, *attach, *attachPod, *pvcName, *namespace)
+	if err != nil {
+		return err
 	}
 
 	// Determine port
@@ -43,9 +96,20 @@ func MountCommand(args []string) error {
 		}
 	}
 
-	meta := internal.NewMetadata(*providerType, *pvcName, selectedPort)
+	meta := internal.NewMetadata(*providerType, key, selectedPort)
 	meta.CustomMountDir = *mountDir
-	meta.Namespace = *namespace
+	meta.KubeOptions = *kubeOptions
+	meta.AttachPod = attachPodName
+	meta.ReadOnly = *readOnly
+	meta.TLS = *useTLS
+	meta.NetworkPolicy = *networkPolicy
+	meta.SFTPAuth = *sftpAuth
+	meta.Pod = podOptions
+	// Record the resolved context, later commands must not depend on the current context
+	meta.Context = client.Context
+	if err := lease.apply(meta); err != nil {
+		return err
+	}
 
 	provider := internal.NewProviderFromMetadata(meta)
 	if provider == nil {
@@ -57,9 +121,9 @@ func MountCommand(args []string) error {
 		return fmt.Errorf("error creating mount directory: %v", err)
 	}
 
-	// Check if mount directory is already mounted
+	// Check if the PVC is already mounted
 	if _, err := os.Stat(meta.ConfigDir); err == nil {
-		return fmt.Errorf("mount directory %s is already mounted", meta.CustomMountDir)
+		return fmt.Errorf("PVC %s is already mounted at %s", key, meta.GetMountDir())
 	}
 
 	// Deploy provider
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"k8s-volume-mount/internal"
+)
+
+// NFSFuseCommand serves the NFS export of a mount through FUSE, it is started by the nfs-fuse mounter
+func NFSFuseCommand(args []string) error {
+	// Parse command line flags
+	nfsFuseCmd := flag.NewFlagSet(internal.NFSFuseCommandName, flag.ExitOnError)
+	configPath := nfsFuseCmd.String("config", "", "Path to the config file of the mount")
+	err := nfsFuseCmd.Parse(args)
+	if err != nil {
+		return fmt.Errorf("error parsing command line flags: %v", err)
+	}
+
+	// Validate arguments
+	if *configPath == "" {
+		return fmt.Errorf("config file must be specified")
+	}
+
+	meta := internal.Metadata{}
+	if err := meta.Load(*configPath); err != nil {
+		return fmt.Errorf("error loading metadata: %v", err)
+	}
+
+	return internal.RunNFSFuse(&meta)
+}
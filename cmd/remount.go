@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"k8s-volume-mount/internal"
+)
+
+// RemountCommand handles the remount command execution, it reconnects a mount from its saved configuration
+func RemountCommand(args []string) error {
+	// Parse command line flags
+	remountCmd := flag.NewFlagSet("remount", flag.ExitOnError)
+	selection := addMountFlags(remountCmd)
+	err := remountCmd.Parse(args)
+	if err != nil {
+		return fmt.Errorf("error parsing command line flags: %v", err)
+	}
+
+	meta, err := selection.findMount()
+	if err != nil {
+		return err
+	}
+
+	p := internal.NewProviderFromMetadata(meta)
+	if p == nil {
+		return fmt.Errorf("could not create provider for provider type: %s", meta.ProviderType)
+	}
+
+	fmt.Printf("Reconnecting volume %s...\n", meta.Key())
+	if err := p.Remount(); err != nil {
+		return fmt.Errorf("error remounting volume: %v", err)
+	}
+
+	if meta.MountMethod == "" {
+		fmt.Printf("Volume %s available at port %d via %s server\n", meta.PVCName, meta.LocalPort, p.Name())
+	} else {
+		fmt.Printf("Volume %s successfully mounted at %s using %s\n", meta.PVCName, meta.GetMountDir(), p.Name())
+	}
+	return nil
+}
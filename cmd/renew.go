@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"k8s-volume-mount/internal"
+	"time"
+)
+
+// RenewCommand handles the renew command execution, it extends the lifetime of a server with a TTL or idle timeout
+func RenewCommand(args []string) error {
+	// Parse command line flags
+	renewCmd := flag.NewFlagSet("renew", flag.ExitOnError)
+	selection := addMountFlags(renewCmd)
+	ttl := renewCmd.Duration("ttl", 0, "New TTL counted from now (optional, default: the TTL of the mount)")
+	err := renewCmd.Parse(args)
+	if err != nil {
+		return fmt.Errorf("error parsing command line flags: %v", err)
+	}
+	if *ttl < 0 {
+		return fmt.Errorf("error: -ttl must be positive")
+	}
+
+	meta, err := selection.findMount()
+	if err != nil {
+		return err
+	}
+
+	expiry, err := internal.RenewServer(meta, *ttl)
+	if err != nil {
+		return fmt.Errorf("error renewing server: %v", err)
+	}
+
+	fmt.Printf("The server of %s expires at %s\n", meta.Key(), expiry.Local().Format(time.RFC1123))
+	if meta.IdleTimeout > 0 {
+		fmt.Printf("The daemon of the mount renews it every %s while the volume is used\n", internal.LeaseRenewInterval(meta.IdleTimeout))
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"k8s-volume-mount/internal"
+)
+
+// ErrUnhealthy is returned by the status command if a check failed, the process exits with ExitUnhealthy
+var ErrUnhealthy = errors.New("mount is unhealthy")
+
+// Exit codes of the status command
+const (
+	// ExitError is used if the status couldn't be determined, e.g. the mount doesn't exist
+	ExitError = 1
+
+	// ExitUnhealthy is used if at least one check failed
+	ExitUnhealthy = 2
+)
+
+// StatusCommand handles the status command execution, it checks every part of a mount
+func StatusCommand(args []string) error {
+	// Parse command line flags
+	statusCmd := flag.NewFlagSet("status", flag.ExitOnError)
+	selection := addMountFlags(statusCmd)
+	err := statusCmd.Parse(args)
+	if err != nil {
+		return fmt.Errorf("error parsing command line flags: %v", err)
+	}
+
+	meta, err := selection.findMount()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Status of %s (%s):\n", meta.Key(), meta.ProviderType)
+	checks := internal.CheckHealth(meta)
+	for _, check := range checks {
+		fmt.Printf("  %-16s %-8s %s\n", check.Name, check.Status, check.Message)
+	}
+
+	if !internal.IsHealthy(checks) {
+		return ErrUnhealthy
+	}
+	return nil
+}
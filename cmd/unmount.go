@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"k8s-volume-mount/internal"
+)
+
+// UnmountCommand handles the unmount command execution, it only disconnects the local mount
+func UnmountCommand(args []string) error {
+	// Parse command line flags
+	unmountCmd := flag.NewFlagSet("unmount", flag.ExitOnError)
+	selection := addMountFlags(unmountCmd)
+	stopForwarding := unmountCmd.Bool("stop-forward", false, "Stop port forwarding as well, the server keeps running")
+	err := unmountCmd.Parse(args)
+	if err != nil {
+		return fmt.Errorf("error parsing command line flags: %v", err)
+	}
+
+	meta, err := selection.findMount()
+	if err != nil {
+		return err
+	}
+
+	p := internal.NewProviderFromMetadata(meta)
+	if p == nil {
+		return fmt.Errorf("could not create provider for provider type: %s", meta.ProviderType)
+	}
+
+	if err := p.Unmount(*stopForwarding); err != nil {
+		return err
+	}
+
+	fmt.Printf("Volume %s unmounted, the %s server is kept. Run remount to mount it again or cleanup to remove it\n", meta.Key(), meta.ProviderType)
+	return nil
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 )
@@ -11,6 +12,13 @@ const (
 	PortRangeStart = 10000
 	PortRangeEnd   = 10100
 
+	// PassivePortRangeStart Port range for the passive data connections of the FTP provider
+	PassivePortRangeStart = 30000
+	PassivePortRangeEnd   = 30999
+
+	// FTPPassivePorts is the number of passive ports forwarded for an FTP server, it limits concurrent transfers
+	FTPPassivePorts = 10
+
 	// DefaultTempDir Default temporary directory
 	DefaultTempDir = "/tmp/k8s-volume-mount"
 
@@ -25,6 +33,15 @@ var (
 
 	// MountBaseDir is the base directory for mounting volumes
 	MountBaseDir = filepath.Join(os.Getenv("HOME"), getEnvOrDefault("K8S_VOLUME_MOUNT_MOUNT_DIR", DefaultMountBaseDir))
+
+	// PodConfigFile is the default file with pod options for the server, it is optional
+	PodConfigFile = getEnvOrDefault("K8S_VOLUME_MOUNT_POD_CONFIG", filepath.Join(getUserConfigDir(), "k8s-volume-mount", "pod.yaml"))
+
+	// CredentialStoreName selects the credential store for new mounts, by default it is detected
+	CredentialStoreName = os.Getenv("K8S_VOLUME_MOUNT_CREDENTIAL_STORE")
+
+	// CredentialsDir is the directory of the encrypted file credential store
+	CredentialsDir = filepath.Join(getUserConfigDir(), "k8s-volume-mount", "credentials")
 )
 
 // getEnvOrDefault returns the value of the environment variable or the default value
@@ -35,6 +52,14 @@ func getEnvOrDefault(envVar, defaultValue string) string {
 	return defaultValue
 }
 
+// getUserConfigDir returns the configuration directory of the user, e.g. ~/.config
+func getUserConfigDir() string {
+	if dir, err := os.UserConfigDir(); err == nil {
+		return dir
+	}
+	return filepath.Join(os.Getenv("HOME"), ".config")
+}
+
 // Initialize creates necessary directories
 func Initialize() error {
 	// Create temp directory if it doesn't exist
@@ -47,5 +72,10 @@ func Initialize() error {
 		return err
 	}
 
+	// Move mounts of former versions to the current state layout
+	if err := MigrateLegacyMetadata(); err != nil {
+		fmt.Printf("Warning: Error migrating mount information: %v\n", err)
+	}
+
 	return nil
 }
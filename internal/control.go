@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ControlHandler handles a single command received on a control socket
+type ControlHandler func(command string) (response string, err error)
+
+// ServeControlSocket listens on a unix socket and passes every received line to the handler.
+// The returned listener must be closed by the caller.
+func ServeControlSocket(socketPath string, handler ControlHandler) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0700); err != nil {
+		return nil, fmt.Errorf("error creating socket directory: %v", err)
+	}
+
+	// a stale socket file of a crashed process would make listening fail
+	_ = os.Remove(socketPath)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %v", err)
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handleControlConnection(conn, handler)
+		}
+	}()
+
+	return listener, nil
+}
+
+func handleControlConnection(conn net.Conn, handler ControlHandler) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	command, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+
+	response, err := handler(strings.TrimSpace(command))
+	if err != nil {
+		_, _ = fmt.Fprintf(conn, "error: %v\n", err)
+		return
+	}
+	_, _ = fmt.Fprintf(conn, "ok: %s\n", response)
+}
+
+// ErrNoDaemon is returned if no process is listening on a control socket
+var ErrNoDaemon = errors.New("no daemon running")
+
+// SendControlCommand sends a command to a control socket and returns the response
+func SendControlCommand(socketPath string, command string) (string, error) {
+	conn, err := net.DialTimeout("unix", socketPath, 2*time.Second)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNoDaemon, err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if _, err := fmt.Fprintf(conn, "%s\n", command); err != nil {
+		return "", fmt.Errorf("failed to send command: %v", err)
+	}
+
+	response, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %v", err)
+	}
+
+	response = strings.TrimSpace(response)
+	if message, ok := strings.CutPrefix(response, "error: "); ok {
+		return "", errors.New(message)
+	}
+
+	return strings.TrimSpace(strings.TrimPrefix(response, "ok:")), nil
+}
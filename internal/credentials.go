@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// Credential store backends
+const (
+	// CredentialStoreSecretService stores credentials in the keyring of the desktop session (Secret Service API)
+	CredentialStoreSecretService = "secret-service"
+
+	// CredentialStoreFile stores credentials in files encrypted with a key in the user config directory
+	CredentialStoreFile = "file"
+)
+
+// CredentialStore keeps the secrets of mounts outside the config directory
+type CredentialStore interface {
+	// Name returns the name of the backend, it is recorded in the metadata of the mount
+	Name() string
+
+	// Set stores a secret, an existing secret with the same key is replaced
+	Set(key string, label string, secret string) error
+
+	// Get returns a stored secret
+	Get(key string) (string, error)
+
+	// Delete removes a secret, a secret that doesn't exist is not an error
+	Delete(key string) error
+}
+
+// CredentialPrompts allows credential stores to ask the user, e.g. to unlock the keyring. Background processes disable it.
+var CredentialPrompts = true
+
+// NewCredentialStore returns the credential store backend with the given name
+func NewCredentialStore(name string) (CredentialStore, error) {
+	switch name {
+	case CredentialStoreSecretService:
+		return NewSecretServiceStore(), nil
+	case CredentialStoreFile:
+		return NewFileCredentialStore(CredentialsDir), nil
+	default:
+		return nil, fmt.Errorf("unknown credential store %s, use %s or %s", name, CredentialStoreSecretService, CredentialStoreFile)
+	}
+}
+
+// DefaultCredentialStore returns the credential store for new mounts: the backend configured with
+// K8S_VOLUME_MOUNT_CREDENTIAL_STORE, otherwise the Secret Service if it is available and the encrypted file store if not
+func DefaultCredentialStore() (CredentialStore, error) {
+	if CredentialStoreName != "" {
+		return NewCredentialStore(CredentialStoreName)
+	}
+
+	secretService := NewSecretServiceStore()
+	if secretService.Available() {
+		return secretService, nil
+	}
+	return NewFileCredentialStore(CredentialsDir), nil
+}
+
+// FileCredentialStore stores every secret in its own file encrypted with NaCl secretbox.
+// The key is generated on first use and stored next to the secrets, both are only readable by the user.
+type FileCredentialStore struct {
+	Dir string
+}
+
+// NewFileCredentialStore creates a file credential store in the given directory
+func NewFileCredentialStore(dir string) *FileCredentialStore {
+	return &FileCredentialStore{Dir: dir}
+}
+
+// Name returns the name of the backend
+func (s *FileCredentialStore) Name() string {
+	return CredentialStoreFile
+}
+
+// getKeyPath returns the path to the encryption key
+func (s *FileCredentialStore) getKeyPath() string {
+	return filepath.Join(s.Dir, "credentials.key")
+}
+
+// getSecretPath returns the path to the encrypted secret of a key
+func (s *FileCredentialStore) getSecretPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:16])+".secret")
+}
+
+// loadKey reads the encryption key, it is generated if it doesn't exist yet
+func (s *FileCredentialStore) loadKey() (*[32]byte, error) {
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create credentials directory: %v", err)
+	}
+
+	key := new([32]byte)
+	data, err := os.ReadFile(s.getKeyPath())
+	if err == nil {
+		if len(data) != len(key) {
+			return nil, fmt.Errorf("invalid credentials key %s", s.getKeyPath())
+		}
+		copy(key[:], data)
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read credentials key: %v", err)
+	}
+
+	if _, err := rand.Read(key[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate credentials key: %v", err)
+	}
+
+	// The key is written to a temporary file and linked into place,
+	// so a concurrent mount never reads a partially written key
+	file, err := os.CreateTemp(s.Dir, "credentials.key.*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create credentials key: %v", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(key[:])
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write credentials key: %v", err)
+	}
+
+	err = os.Link(file.Name(), s.getKeyPath())
+	if errors.Is(err, os.ErrExist) {
+		// created by a concurrent mount
+		return s.loadKey()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create credentials key: %v", err)
+	}
+	return key, nil
+}
+
+// Set encrypts a secret and writes it to its file
+func (s *FileCredentialStore) Set(key string, label string, secret string) error {
+	encryptionKey, err := s.loadKey()
+	if err != nil {
+		return err
+	}
+
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	data := secretbox.Seal(nonce[:], []byte(secret), &nonce, encryptionKey)
+
+	if err := os.WriteFile(s.getSecretPath(key), data, 0600); err != nil {
+		return fmt.Errorf("failed to write secret: %v", err)
+	}
+	return nil
+}
+
+// Get reads and decrypts a secret
+func (s *FileCredentialStore) Get(key string) (string, error) {
+	data, err := os.ReadFile(s.getSecretPath(key))
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret: %v", err)
+	}
+	encryptionKey, err := s.loadKey()
+	if err != nil {
+		return "", err
+	}
+
+	var nonce [24]byte
+	if len(data) < len(nonce) {
+		return "", fmt.Errorf("invalid secret %s", s.getSecretPath(key))
+	}
+	copy(nonce[:], data)
+	secret, ok := secretbox.Open(nil, data[len(nonce):], &nonce, encryptionKey)
+	if !ok {
+		return "", fmt.Errorf("failed to decrypt secret %s", s.getSecretPath(key))
+	}
+	return string(secret), nil
+}
+
+// Delete removes the file of a secret
+func (s *FileCredentialStore) Delete(key string) error {
+	err := os.Remove(s.getSecretPath(key))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete secret: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// Names of the Secret Service API, see https://specifications.freedesktop.org/secret-service-spec/latest/
+const (
+	secretServiceName         = "org.freedesktop.secrets"
+	secretServicePath         = dbus.ObjectPath("/org/freedesktop/secrets")
+	secretServiceInterface    = "org.freedesktop.Secret.Service"
+	secretCollectionInterface = "org.freedesktop.Secret.Collection"
+	secretItemInterface       = "org.freedesktop.Secret.Item"
+	secretSessionInterface    = "org.freedesktop.Secret.Session"
+	secretPromptInterface     = "org.freedesktop.Secret.Prompt"
+	secretAttributeApp        = "application"
+	secretAttributeKey        = "mount"
+	secretApplicationName     = "k8s-volume-mount"
+	secretNoObject            = dbus.ObjectPath("/")
+	secretDefaultCollection   = "default"
+
+	// secretServicePromptTimeout is how long the user has to complete a prompt, e.g. to unlock the keyring
+	secretServicePromptTimeout = 2 * time.Minute
+)
+
+// secretServiceSecret is the Secret struct of the Secret Service API
+type secretServiceSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// SecretServiceStore stores credentials in the default collection of the Secret Service of the session bus,
+// e.g. GNOME Keyring or KWallet. Secrets are transferred unencrypted over the session bus, which only the user can access.
+type SecretServiceStore struct {
+	// Connect opens the bus the Secret Service is reached on, a connection is opened for every operation
+	Connect func() (*dbus.Conn, error)
+
+	// Prompt allows the Secret Service to ask the user on the desktop, e.g. to unlock the keyring.
+	// Without it operations that need a prompt fail.
+	Prompt bool
+
+	// PromptTimeout is how long to wait for the user to complete a prompt
+	PromptTimeout time.Duration
+}
+
+// NewSecretServiceStore creates a Secret Service credential store on the session bus given by DBUS_SESSION_BUS_ADDRESS.
+// Prompts are shown on the desktop, nobody would complete them in the background or in a session without display.
+func NewSecretServiceStore() *SecretServiceStore {
+	return &SecretServiceStore{
+		Connect:       func() (*dbus.Conn, error) { return dbus.ConnectSessionBus() },
+		Prompt:        CredentialPrompts && (os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""),
+		PromptTimeout: secretServicePromptTimeout,
+	}
+}
+
+// Name returns the name of the backend
+func (s *SecretServiceStore) Name() string {
+	return CredentialStoreSecretService
+}
+
+// Available checks if a Secret Service with a default collection is reachable on the session bus.
+// A locked collection is only usable if the user can be asked to unlock it.
+func (s *SecretServiceStore) Available() bool {
+	session, err := s.openSession()
+	if err != nil {
+		return false
+	}
+	defer session.close()
+
+	collection, err := session.defaultCollection()
+	if err != nil {
+		return false
+	}
+	return s.Prompt || !session.isLocked(collection)
+}
+
+// Set stores a secret as item of the default collection, replacing an existing item of the same key
+func (s *SecretServiceStore) Set(key string, label string, secret string) error {
+	session, err := s.openSession()
+	if err != nil {
+		return err
+	}
+	defer session.close()
+
+	collection, err := session.defaultCollection()
+	if err != nil {
+		return err
+	}
+	if err := session.unlock([]dbus.ObjectPath{collection}); err != nil {
+		return err
+	}
+
+	properties := map[string]dbus.Variant{
+		secretItemInterface + ".Label":      dbus.MakeVariant(label),
+		secretItemInterface + ".Attributes": dbus.MakeVariant(secretAttributes(key)),
+	}
+	value := secretServiceSecret{Session: session.path, Value: []byte(secret), ContentType: "text/plain"}
+
+	var item, prompt dbus.ObjectPath
+	err = session.conn.Object(secretServiceName, collection).
+		Call(secretCollectionInterface+".CreateItem", 0, properties, value, true).
+		Store(&item, &prompt)
+	if err != nil {
+		return fmt.Errorf("failed to create secret service item: %v", err)
+	}
+	return session.prompt(prompt)
+}
+
+// Get returns the secret of the item with the given key
+func (s *SecretServiceStore) Get(key string) (string, error) {
+	session, err := s.openSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.close()
+
+	items, err := session.searchItems(key)
+	if err != nil {
+		return "", err
+	}
+	if len(items) == 0 {
+		return "", fmt.Errorf("no secret found for %s in the secret service", key)
+	}
+
+	var value secretServiceSecret
+	err = session.conn.Object(secretServiceName, items[0]).
+		Call(secretItemInterface+".GetSecret", 0, session.path).
+		Store(&value)
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret: %v", err)
+	}
+	return string(value.Value), nil
+}
+
+// Delete removes all items with the given key
+func (s *SecretServiceStore) Delete(key string) error {
+	session, err := s.openSession()
+	if err != nil {
+		return err
+	}
+	defer session.close()
+
+	items, err := session.searchItems(key)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		var prompt dbus.ObjectPath
+		if err := session.conn.Object(secretServiceName, item).Call(secretItemInterface+".Delete", 0).Store(&prompt); err != nil {
+			return fmt.Errorf("failed to delete secret: %v", err)
+		}
+		if err := session.prompt(prompt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// secretAttributes returns the lookup attributes of the item of a key
+func secretAttributes(key string) map[string]string {
+	return map[string]string{
+		secretAttributeApp: secretApplicationName,
+		secretAttributeKey: key,
+	}
+}
+
+// secretServiceSession is an open session with the Secret Service using the "plain" algorithm
+type secretServiceSession struct {
+	store   *SecretServiceStore
+	conn    *dbus.Conn
+	service dbus.BusObject
+	path    dbus.ObjectPath
+}
+
+// openSession connects to the bus and opens a Secret Service session
+func (s *SecretServiceStore) openSession() (*secretServiceSession, error) {
+	conn, err := s.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the session bus: %v", err)
+	}
+
+	service := conn.Object(secretServiceName, secretServicePath)
+	var output dbus.Variant
+	var path dbus.ObjectPath
+	if err := service.Call(secretServiceInterface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &path); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to open secret service session: %v", err)
+	}
+
+	return &secretServiceSession{store: s, conn: conn, service: service, path: path}, nil
+}
+
+// close closes the session and the bus connection
+func (s *secretServiceSession) close() {
+	_ = s.conn.Object(secretServiceName, s.path).Call(secretSessionInterface+".Close", 0).Err
+	_ = s.conn.Close()
+}
+
+// defaultCollection returns the path of the default collection
+func (s *secretServiceSession) defaultCollection() (dbus.ObjectPath, error) {
+	var collection dbus.ObjectPath
+	if err := s.service.Call(secretServiceInterface+".ReadAlias", 0, secretDefaultCollection).Store(&collection); err != nil {
+		return "", fmt.Errorf("failed to read default collection: %v", err)
+	}
+	if collection == secretNoObject {
+		return "", fmt.Errorf("the secret service has no default collection")
+	}
+	return collection, nil
+}
+
+// isLocked checks if a collection is locked, a collection whose state can't be read counts as locked
+func (s *secretServiceSession) isLocked(collection dbus.ObjectPath) bool {
+	locked, err := s.conn.Object(secretServiceName, collection).GetProperty(secretCollectionInterface + ".Locked")
+	if err != nil {
+		return true
+	}
+	value, ok := locked.Value().(bool)
+	return !ok || value
+}
+
+// searchItems returns the items with the given key, locked items are unlocked
+func (s *secretServiceSession) searchItems(key string) ([]dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	if err := s.service.Call(secretServiceInterface+".SearchItems", 0, secretAttributes(key)).Store(&unlocked, &locked); err != nil {
+		return nil, fmt.Errorf("failed to search secret service: %v", err)
+	}
+	if len(locked) > 0 {
+		if err := s.unlock(locked); err != nil {
+			return nil, err
+		}
+	}
+	return append(unlocked, locked...), nil
+}
+
+// unlock unlocks collections or items, the user may be asked for the password of the keyring
+func (s *secretServiceSession) unlock(objects []dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	if err := s.service.Call(secretServiceInterface+".Unlock", 0, objects).Store(&unlocked, &prompt); err != nil {
+		return fmt.Errorf("failed to unlock secret service: %v", err)
+	}
+	return s.prompt(prompt)
+}
+
+// prompt shows a prompt of the Secret Service and waits until the user completed it, at most for the prompt timeout
+func (s *secretServiceSession) prompt(prompt dbus.ObjectPath) error {
+	if prompt == secretNoObject || prompt == "" {
+		return nil
+	}
+	if !s.store.Prompt {
+		return fmt.Errorf("the secret service needs to ask for confirmation, e.g. to unlock the keyring, which isn't possible in this session; unlock the keyring and try again")
+	}
+
+	if err := s.conn.AddMatchSignal(dbus.WithMatchObjectPath(prompt), dbus.WithMatchInterface(secretPromptInterface)); err != nil {
+		return fmt.Errorf("failed to watch secret service prompt: %v", err)
+	}
+	signals := make(chan *dbus.Signal, 1)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+
+	if err := s.conn.Object(secretServiceName, prompt).Call(secretPromptInterface+".Prompt", 0, "").Err; err != nil {
+		return fmt.Errorf("failed to show secret service prompt: %v", err)
+	}
+
+	timeout := time.After(s.store.PromptTimeout)
+	for {
+		select {
+		case signal, ok := <-signals:
+			if !ok {
+				return fmt.Errorf("secret service connection closed while waiting for prompt")
+			}
+			if signal.Path != prompt || signal.Name != secretPromptInterface+".Completed" {
+				continue
+			}
+			if len(signal.Body) == 0 {
+				return fmt.Errorf("secret service prompt completed without result")
+			}
+			if dismissed, ok := signal.Body[0].(bool); ok && dismissed {
+				return fmt.Errorf("secret service prompt was dismissed")
+			}
+			return nil
+		case <-timeout:
+			_ = s.conn.Object(secretServiceName, prompt).Call(secretPromptInterface+".Dismiss", 0).Err
+			return fmt.Errorf("secret service prompt wasn't completed within %s", s.store.PromptTimeout)
+		}
+	}
+}
@@ -0,0 +1,503 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestFileCredentialStoreRoundTrip(t *testing.T) {
+	store := NewFileCredentialStore(filepath.Join(t.TempDir(), "credentials"))
+
+	if err := store.Set("ctx/ns/pvc", "label", "secret password"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	secret, err := store.Get("ctx/ns/pvc")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if secret != "secret password" {
+		t.Errorf("Get = %q, want %q", secret, "secret password")
+	}
+
+	// the secret must not be stored in cleartext
+	data, err := os.ReadFile(store.getSecretPath("ctx/ns/pvc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret password") {
+		t.Error("secret file contains the secret in cleartext")
+	}
+
+	for _, path := range []string{store.getKeyPath(), store.getSecretPath("ctx/ns/pvc")} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("%s has mode %v, want 0600", path, info.Mode().Perm())
+		}
+	}
+
+	if err := store.Delete("ctx/ns/pvc"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get("ctx/ns/pvc"); err == nil {
+		t.Error("Get after Delete succeeded")
+	}
+	if err := store.Delete("ctx/ns/pvc"); err != nil {
+		t.Errorf("Delete of a missing secret: %v", err)
+	}
+}
+
+func TestFileCredentialStoreTampering(t *testing.T) {
+	store := NewFileCredentialStore(t.TempDir())
+	if err := store.Set("key", "label", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	path := store.getSecretPath("key")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0x01
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("key"); err == nil {
+		t.Error("Get of a modified secret succeeded")
+	}
+
+	if err := os.WriteFile(path, data[:10], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("key"); err == nil {
+		t.Error("Get of a truncated secret succeeded")
+	}
+
+	// a secret encrypted with another key is rejected
+	other := NewFileCredentialStore(t.TempDir())
+	if err := other.Set("key", "label", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(other.getSecretPath("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("key"); err == nil {
+		t.Error("Get of a secret encrypted with another key succeeded")
+	}
+}
+
+func TestFileCredentialStoreConcurrentKeyCreation(t *testing.T) {
+	dir := t.TempDir()
+
+	// every mount creates its own store, the first one generates the key
+	const mounts = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, mounts)
+	for i := range mounts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			store := NewFileCredentialStore(dir)
+			errs <- store.Set(fmt.Sprintf("mount-%d", i), "label", fmt.Sprintf("secret-%d", i))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+
+	store := NewFileCredentialStore(dir)
+	for i := range mounts {
+		secret, err := store.Get(fmt.Sprintf("mount-%d", i))
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if want := fmt.Sprintf("secret-%d", i); secret != want {
+			t.Errorf("Get = %q, want %q", secret, want)
+		}
+	}
+
+	// no temporary key files are left behind
+	matches, err := filepath.Glob(filepath.Join(dir, "credentials.key.*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) > 0 {
+		t.Errorf("temporary key files left: %v", matches)
+	}
+}
+
+func TestSecretServiceStore(t *testing.T) {
+	address := startTestBus(t)
+	startTestSecretService(t, address)
+
+	store := &SecretServiceStore{Connect: func() (*dbus.Conn, error) { return dbus.Connect(address) }}
+	if !store.Available() {
+		t.Fatal("secret service not available")
+	}
+
+	if err := store.Set("ctx/ns/pvc", "label", "first"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	// setting a key again replaces its secret
+	if err := store.Set("ctx/ns/pvc", "label", "second"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := store.Set("ctx/ns/other", "label", "other"); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	secret, err := store.Get("ctx/ns/pvc")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if secret != "second" {
+		t.Errorf("Get = %q, want %q", secret, "second")
+	}
+
+	if err := store.Delete("ctx/ns/pvc"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get("ctx/ns/pvc"); err == nil {
+		t.Error("Get after Delete succeeded")
+	}
+	if err := store.Delete("ctx/ns/pvc"); err != nil {
+		t.Errorf("Delete of a missing secret: %v", err)
+	}
+
+	secret, err = store.Get("ctx/ns/other")
+	if err != nil || secret != "other" {
+		t.Errorf("Get of another key = %q, %v", secret, err)
+	}
+}
+
+func TestSecretServiceStoreLocked(t *testing.T) {
+	address := startTestBus(t)
+	service := startTestSecretService(t, address)
+	service.locked = true
+
+	connect := func() (*dbus.Conn, error) { return dbus.Connect(address) }
+	noPrompt := &SecretServiceStore{Connect: connect}
+	if noPrompt.Available() {
+		t.Error("locked secret service available without prompts")
+	}
+	if err := noPrompt.Set("ctx/ns/pvc", "label", "secret"); err == nil {
+		t.Error("Set without prompts succeeded on a locked collection")
+	}
+
+	// nobody completes the prompt
+	service.promptMode = testPromptIgnore
+	store := &SecretServiceStore{Connect: connect, Prompt: true, PromptTimeout: 200 * time.Millisecond}
+	if !store.Available() {
+		t.Error("locked secret service not available with prompts")
+	}
+	start := time.Now()
+	if err := store.Set("ctx/ns/pvc", "label", "secret"); err == nil || !strings.Contains(err.Error(), "wasn't completed") {
+		t.Errorf("Set with an ignored prompt = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Set took %s with a prompt timeout of %s", elapsed, store.PromptTimeout)
+	}
+
+	service.promptMode = testPromptEmpty
+	if err := store.Set("ctx/ns/pvc", "label", "secret"); err == nil || !strings.Contains(err.Error(), "without result") {
+		t.Errorf("Set with a prompt result without body = %v", err)
+	}
+
+	service.promptMode = testPromptUnlock
+	if err := store.Set("ctx/ns/pvc", "label", "secret"); err != nil {
+		t.Errorf("Set with an unlocking prompt: %v", err)
+	}
+}
+
+func TestSecretServiceStoreUnavailable(t *testing.T) {
+	address := startTestBus(t)
+
+	// nobody owns the name of the Secret Service on this bus
+	store := &SecretServiceStore{Connect: func() (*dbus.Conn, error) { return dbus.Connect(address) }}
+	if store.Available() {
+		t.Error("secret service available without a service on the bus")
+	}
+}
+
+// startTestBus starts a private message bus and returns its address
+func startTestBus(t *testing.T) string {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "bus.conf")
+	err = os.WriteFile(config, []byte(`<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:path=`+filepath.Join(dir, "bus")+`</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file", config, "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("failed to read bus address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+// testSecretService is a stand-in for a Secret Service with a single collection, unlocking it prompts as given by promptMode
+type testSecretService struct {
+	conn *dbus.Conn
+
+	mu         sync.Mutex
+	items      map[dbus.ObjectPath]*testSecretItem
+	nextID     int
+	locked     bool
+	promptMode int
+}
+
+// How the prompt of the stand-in completes
+const (
+	// testPromptUnlock unlocks the collection and completes the prompt
+	testPromptUnlock = iota
+	// testPromptIgnore never completes the prompt
+	testPromptIgnore
+	// testPromptEmpty sends a Completed signal without arguments
+	testPromptEmpty
+)
+
+// testSecretItem is an item of the stand-in collection
+type testSecretItem struct {
+	service    *testSecretService
+	path       dbus.ObjectPath
+	attributes map[string]string
+	secret     []byte
+}
+
+const testCollectionPath = dbus.ObjectPath("/org/freedesktop/secrets/collection/login")
+
+// startTestSecretService exports the stand-in Secret Service on the bus
+func startTestSecretService(t *testing.T, address string) *testSecretService {
+	t.Helper()
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	service := &testSecretService{conn: conn, items: map[dbus.ObjectPath]*testSecretItem{}}
+	if err := conn.Export(service, secretServicePath, secretServiceInterface); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Export(testSecretCollection{service}, testCollectionPath, secretCollectionInterface); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Export(testSecretCollection{service}, testCollectionPath, "org.freedesktop.DBus.Properties"); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := conn.RequestName(secretServiceName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("failed to own %s: %v", secretServiceName, err)
+	}
+	return service
+}
+
+func (s *testSecretService) OpenSession(algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if algorithm != "plain" {
+		return dbus.Variant{}, "", dbus.MakeFailedError(fmt.Errorf("unsupported algorithm %s", algorithm))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	path := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/secrets/session/%d", s.nextID))
+	if err := s.conn.Export(testSecretSession{}, path, secretSessionInterface); err != nil {
+		return dbus.Variant{}, "", dbus.MakeFailedError(err)
+	}
+	return dbus.MakeVariant(""), path, nil
+}
+
+func (s *testSecretService) ReadAlias(name string) (dbus.ObjectPath, *dbus.Error) {
+	if name != secretDefaultCollection {
+		return secretNoObject, nil
+	}
+	return testCollectionPath, nil
+}
+
+func (s *testSecretService) SearchItems(attributes map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var unlocked []dbus.ObjectPath
+	for path, item := range s.items {
+		if item.matches(attributes) {
+			unlocked = append(unlocked, path)
+		}
+	}
+	return unlocked, []dbus.ObjectPath{}, nil
+}
+
+func (s *testSecretService) Unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.locked {
+		return objects, secretNoObject, nil
+	}
+
+	s.nextID++
+	path := dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/secrets/prompt/%d", s.nextID))
+	if err := s.conn.Export(&testSecretPrompt{service: s, path: path}, path, secretPromptInterface); err != nil {
+		return nil, "", dbus.MakeFailedError(err)
+	}
+	return []dbus.ObjectPath{}, path, nil
+}
+
+// testSecretPrompt is a prompt of the stand-in to unlock the collection
+type testSecretPrompt struct {
+	service *testSecretService
+	path    dbus.ObjectPath
+}
+
+func (p *testSecretPrompt) Prompt(windowID string) *dbus.Error {
+	s := p.service
+	s.mu.Lock()
+	mode := s.promptMode
+	if mode == testPromptUnlock {
+		s.locked = false
+	}
+	s.mu.Unlock()
+
+	var err error
+	switch mode {
+	case testPromptUnlock:
+		err = s.conn.Emit(p.path, secretPromptInterface+".Completed", false, dbus.MakeVariant([]dbus.ObjectPath{testCollectionPath}))
+	case testPromptEmpty:
+		err = s.conn.Emit(p.path, secretPromptInterface+".Completed")
+	}
+	if err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+func (p *testSecretPrompt) Dismiss() *dbus.Error {
+	return nil
+}
+
+// testSecretCollection is the default collection of the stand-in
+type testSecretCollection struct {
+	service *testSecretService
+}
+
+// Get returns the properties of the collection, only Locked is supported
+func (c testSecretCollection) Get(iface string, name string) (dbus.Variant, *dbus.Error) {
+	if iface != secretCollectionInterface || name != "Locked" {
+		return dbus.Variant{}, dbus.MakeFailedError(fmt.Errorf("unknown property %s.%s", iface, name))
+	}
+	c.service.mu.Lock()
+	defer c.service.mu.Unlock()
+	return dbus.MakeVariant(c.service.locked), nil
+}
+
+func (c testSecretCollection) CreateItem(properties map[string]dbus.Variant, secret secretServiceSecret, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	attributes, ok := properties[secretItemInterface+".Attributes"].Value().(map[string]string)
+	if !ok {
+		return "", "", dbus.MakeFailedError(fmt.Errorf("missing attributes"))
+	}
+
+	s := c.service
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if replace {
+		for path, item := range s.items {
+			if item.matches(attributes) {
+				item.secret = secret.Value
+				return path, secretNoObject, nil
+			}
+		}
+	}
+
+	s.nextID++
+	item := &testSecretItem{
+		service:    s,
+		path:       dbus.ObjectPath(fmt.Sprintf("%s/%d", testCollectionPath, s.nextID)),
+		attributes: attributes,
+		secret:     secret.Value,
+	}
+	if err := s.conn.Export(item, item.path, secretItemInterface); err != nil {
+		return "", "", dbus.MakeFailedError(err)
+	}
+	s.items[item.path] = item
+	return item.path, secretNoObject, nil
+}
+
+func (i *testSecretItem) matches(attributes map[string]string) bool {
+	for key, value := range attributes {
+		if i.attributes[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func (i *testSecretItem) GetSecret(session dbus.ObjectPath) (secretServiceSecret, *dbus.Error) {
+	i.service.mu.Lock()
+	defer i.service.mu.Unlock()
+	return secretServiceSecret{Session: session, Value: i.secret, ContentType: "text/plain"}, nil
+}
+
+func (i *testSecretItem) Delete() (dbus.ObjectPath, *dbus.Error) {
+	s := i.service
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, i.path)
+	if err := s.conn.Export(nil, i.path, secretItemInterface); err != nil {
+		return "", dbus.MakeFailedError(err)
+	}
+	return secretNoObject, nil
+}
+
+// testSecretSession is an open session of the stand-in
+type testSecretSession struct{}
+
+func (testSecretSession) Close() *dbus.Error {
+	return nil
+}
@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// DaemonCommandName is the hidden command that runs the background daemon of a mount
+const DaemonCommandName = "daemon"
+
+// DaemonStatus is reported by a running daemon on the "status" control command
+type DaemonStatus struct {
+	Pid         int       `json:"pid"`
+	Pod         string    `json:"pod"`
+	LocalPort   int       `json:"localPort"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastErrorAt time.Time `json:"lastErrorAt,omitempty"`
+}
+
+// GetControlSocketPath returns the path of the control socket of the mount daemon.
+// The path is derived from the config directory but kept short to stay within the unix socket path limit.
+func (m *Metadata) GetControlSocketPath() string {
+	sum := sha256.Sum256([]byte(m.ConfigDir))
+	return filepath.Join(TempDir, "run", hex.EncodeToString(sum[:8])+".sock")
+}
+
+// RunDaemon runs the supervisor of a mount until it is stopped
+func RunDaemon(meta *Metadata) error {
+	// nobody would answer a prompt of the daemon, e.g. when the password is needed to remount
+	CredentialPrompts = false
+
+	supervisor, err := NewSupervisor(meta)
+	if err != nil {
+		return err
+	}
+	return supervisor.Run()
+}
+
+// StartPortForwarding starts the daemon of a mount in the background and waits until the local port is reachable.
+// The metadata has to be saved before, the daemon reads it from the config file.
+func StartPortForwarding(meta *Metadata, logPath string) (pid int, err error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return pid, fmt.Errorf("failed to determine executable: %v", err)
+	}
+
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return pid, fmt.Errorf("failed to create log file: %v", err)
+	}
+	defer func(logFile *os.File) {
+		err := logFile.Close()
+		if err != nil {
+			fmt.Printf("warning: failed to close log file %s: %v\n", logPath, err)
+		}
+	}(logFile)
+
+	cmd := exec.Command(executable, DaemonCommandName, "-config", meta.GetConfigFilePath())
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+
+	// Set the command to run in its own process group
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+
+	if err := cmd.Start(); err != nil {
+		return pid, fmt.Errorf("failed to start port forwarding: %v", err)
+	}
+	pid = cmd.Process.Pid
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	deadline := time.After(30 * time.Second)
+	for {
+		select {
+		case err := <-exited:
+			logs, _ := os.ReadFile(logPath)
+			return pid, fmt.Errorf("port forwarding exited: %v\nOutput: %s", err, string(logs))
+		case <-deadline:
+			return pid, fmt.Errorf("port forwarding not reachable")
+		case <-time.After(200 * time.Millisecond):
+			if IsPortListening(meta.LocalHostname, meta.LocalPort) {
+				// the daemon keeps running after this program exits
+				return pid, nil
+			}
+		}
+	}
+}
+
+// StopPortForwarding asks the daemon of a mount to stop
+func StopPortForwarding(meta *Metadata) error {
+	_, err := SendControlCommand(meta.GetControlSocketPath(), "stop")
+	if errors.Is(err, ErrNoDaemon) {
+		return nil
+	}
+	return err
+}
+
+// DetachMount tells the daemon of a mount to stop supervising the local mount
+func DetachMount(meta *Metadata) error {
+	_, err := SendControlCommand(meta.GetControlSocketPath(), "detach")
+	if errors.Is(err, ErrNoDaemon) {
+		return nil
+	}
+	return err
+}
+
+// AttachMount tells the daemon of a mount to supervise the local mount again
+func AttachMount(meta *Metadata) error {
+	_, err := SendControlCommand(meta.GetControlSocketPath(), "attach")
+	if errors.Is(err, ErrNoDaemon) {
+		return nil
+	}
+	return err
+}
+
+// GetDaemonStatus queries the status of the daemon of a mount
+func GetDaemonStatus(meta *Metadata) (*DaemonStatus, error) {
+	response, err := SendControlCommand(meta.GetControlSocketPath(), "status")
+	if err != nil {
+		return nil, err
+	}
+
+	status := &DaemonStatus{}
+	if err := json.Unmarshal([]byte(response), status); err != nil {
+		return nil, fmt.Errorf("invalid daemon status: %v", err)
+	}
+	return status, nil
+}
@@ -0,0 +1,301 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Problem is an inconsistency between the local state, the mount table, the running processes and the cluster
+type Problem struct {
+	Description string
+
+	// Fix repairs the problem, nil if it can only be reported
+	Fix func() error
+}
+
+// Diagnose cross-checks the metadata of all mounts with the cluster, the mount table and the running processes.
+// Deployments are searched in the contexts of the mounts and the context of the given options.
+// Checks that can't be run, e.g. because a cluster is unreachable, are reported as warnings.
+func Diagnose(kubeOptions KubeOptions) []Problem {
+	d := &doctor{
+		clients:    map[string]*KubeClient{},
+		mountDirs:  map[string]bool{},
+		configDirs: map[string]*Metadata{},
+	}
+
+	d.checkMetadata()
+	d.checkMountTable()
+	d.checkProcesses()
+	d.checkCluster(kubeOptions)
+
+	return d.problems
+}
+
+// doctor collects the problems found by Diagnose and the state the checks share
+type doctor struct {
+	problems []Problem
+	metadata []*Metadata
+
+	// clients are created once per kubeconfig, context and identity
+	clients map[string]*KubeClient
+
+	// mountDirs and configDirs belong to mounts with valid metadata
+	mountDirs  map[string]bool
+	configDirs map[string]*Metadata
+}
+
+func (d *doctor) report(fix func() error, format string, args ...any) {
+	d.problems = append(d.problems, Problem{Description: fmt.Sprintf(format, args...), Fix: fix})
+}
+
+// client returns the Kubernetes client of a cluster and identity
+func (d *doctor) client(options KubeOptions) (*KubeClient, error) {
+	key := strings.Join(append([]string{options.Kubeconfig, options.Context, options.As}, options.AsGroups...), "\x00")
+
+	if client, ok := d.clients[key]; ok {
+		return client, nil
+	}
+	client, err := NewKubeClient(options)
+	if err != nil {
+		return nil, err
+	}
+	d.clients[key] = client
+	return client, nil
+}
+
+// checkMetadata checks every mount: its server has to exist, its daemon has to run and its mount process has to be alive
+func (d *doctor) checkMetadata() {
+	err := WalkMetadata(func(path string, meta *Metadata, err error) {
+		if err != nil {
+			dir := filepath.Dir(path)
+			d.report(func() error { return os.RemoveAll(dir) }, "metadata %s can't be loaded: %v", path, err)
+			return
+		}
+
+		d.metadata = append(d.metadata, meta)
+		d.mountDirs[meta.GetMountDir()] = true
+		d.configDirs[meta.ConfigDir] = meta
+		d.checkMount(meta)
+	})
+	if err != nil {
+		fmt.Printf("Warning: Error reading metadata: %v\n", err)
+	}
+}
+
+// checkMount checks a single mount, only the most fundamental problem is reported
+func (d *doctor) checkMount(meta *Metadata) {
+	provider := NewProviderFromMetadata(meta)
+	if provider == nil {
+		d.report(meta.Delete, "mount %s has the unknown provider %s", meta.Key(), meta.ProviderType)
+		return
+	}
+
+	gone, err := d.isServerGone(meta)
+	if err != nil {
+		fmt.Printf("Warning: Can't check the server of %s: %v\n", meta.Key(), err)
+	} else if gone {
+		d.report(provider.Cleanup, "the server of %s doesn't exist anymore", meta.Key())
+		return
+	}
+
+	mountDir := meta.GetMountDir()
+	if (meta.MountMethod != "" || meta.PortForwardingPid != 0) && !IsProcessAlive(meta.PortForwardingPid) {
+		d.report(func() error {
+			if meta.MountMethod == "" {
+				// forwarded or unmounted volumes only get their port forwarding back
+				return provider.Reconnect()
+			}
+			if IsMountPoint(mountDir) {
+				if err := ForceUnmount(mountDir); err != nil {
+					return err
+				}
+			}
+			return provider.Remount()
+		}, "port forwarding of %s is not running (pid %d)", meta.Key(), meta.PortForwardingPid)
+		return
+	}
+
+	if meta.MountMethod != "" && meta.MountPid != 0 && !IsProcessAlive(meta.MountPid) && IsMountPoint(mountDir) {
+		// the daemon remounts the volume once the stale mount is gone
+		d.report(func() error { return ForceUnmount(mountDir) },
+			"%s is a stale mount of %s, the %s process (pid %d) is not running", mountDir, meta.Key(), meta.MountMethod, meta.MountPid)
+	}
+}
+
+// isServerGone checks if the deployment or ephemeral container of a mount was removed from the cluster
+func (d *doctor) isServerGone(meta *Metadata) (bool, error) {
+	client, err := d.client(meta.KubeOptions)
+	if err != nil {
+		return false, err
+	}
+
+	if meta.AttachPod != "" {
+		pod, err := client.GetPod(meta.AttachPod, meta.Namespace)
+		if errors.Is(err, ErrNotFound) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return meta.AttachContainer != "" && !IsEphemeralContainerRunning(pod, meta.AttachContainer), nil
+	}
+
+	_, err = client.GetDeployment(meta.ProvisionerName, meta.Namespace)
+	if errors.Is(err, ErrNotFound) {
+		return true, nil
+	}
+	return false, err
+}
+
+// checkMountTable finds mounts in the mount base directory that don't belong to a mount
+func (d *doctor) checkMountTable() {
+	mountPoints, err := ListMountPoints()
+	if err != nil {
+		fmt.Printf("Warning: Can't check the mount table: %v\n", err)
+		return
+	}
+
+	for _, mountPoint := range mountPoints {
+		if !strings.HasPrefix(mountPoint, MountBaseDir+string(filepath.Separator)) || d.mountDirs[mountPoint] {
+			continue
+		}
+		d.report(func() error { return ForceUnmount(mountPoint) }, "%s is mounted but doesn't belong to a mount", mountPoint)
+	}
+}
+
+// checkProcesses finds daemons, FUSE processes and rclone mounts that don't belong to a mount,
+// and kubectl port-forward processes started by former versions
+func (d *doctor) checkProcesses() {
+	processes, err := ListProcesses()
+	if err != nil {
+		fmt.Printf("Warning: Can't check processes: %v\n", err)
+		return
+	}
+
+	for _, process := range processes {
+		if process.Pid == os.Getpid() {
+			continue
+		}
+
+		var orphan bool
+		var name string
+		args := process.Args
+		switch {
+		case len(args) >= 4 && (args[1] == DaemonCommandName || args[1] == NFSFuseCommandName) && args[2] == "-config":
+			if !d.isTempFile(args[3]) {
+				continue
+			}
+			name = args[1]
+			meta := d.configDirs[filepath.Dir(args[3])]
+			orphan = meta == nil ||
+				(args[1] == DaemonCommandName && meta.PortForwardingPid != process.Pid) ||
+				(args[1] == NFSFuseCommandName && meta.MountPid != process.Pid)
+		case len(args) >= 2 && filepath.Base(args[0]) == "rclone" && args[1] == "mount":
+			index := slices.Index(args, "--config")
+			if index < 0 || index+1 >= len(args) || !d.isTempFile(args[index+1]) {
+				continue
+			}
+			name = "rclone mount"
+			meta := d.configDirs[filepath.Dir(args[index+1])]
+			orphan = meta == nil || meta.MountPid != process.Pid
+		case isLegacyPortForward(args):
+			name = "kubectl port-forward"
+			orphan = !slices.ContainsFunc(d.metadata, func(meta *Metadata) bool { return meta.PortForwardingPid == process.Pid })
+		}
+
+		if orphan {
+			pid := process.Pid
+			d.report(func() error { return killProcess(pid) }, "%s process %d doesn't belong to a mount", name, pid)
+		}
+	}
+}
+
+// isTempFile checks if a path is in the temp directory
+func (d *doctor) isTempFile(path string) bool {
+	return strings.HasPrefix(path, TempDir+string(filepath.Separator))
+}
+
+// legacyServiceName matches the services former versions forwarded with kubectl, e.g. svc/webdav-my-pvc-10000.
+// Only the providers of these versions are matched, so port forwardings of the user are left alone.
+var legacyServiceName = regexp.MustCompile(`^svc/(?:webdav|sftp|nfs)-.+-(\d+)$`)
+
+// isLegacyPortForward checks if a process is a kubectl port-forward started by a former version:
+// kubectl port-forward svc/<provider>-<pvc>-<port> <port>:<remote port>, the local port is part of the service name
+func isLegacyPortForward(args []string) bool {
+	if len(args) < 4 || filepath.Base(args[0]) != "kubectl" || args[1] != "port-forward" {
+		return false
+	}
+	match := legacyServiceName.FindStringSubmatch(args[2])
+	if match == nil {
+		return false
+	}
+	localPort, remotePort, found := strings.Cut(args[3], ":")
+	if !found || localPort != match[1] {
+		return false
+	}
+	_, err := strconv.Atoi(remotePort)
+	return err == nil
+}
+
+// checkCluster finds deployments created by this client that don't belong to a mount,
+// and deployments of any client that weren't removed after they expired
+func (d *doctor) checkCluster(kubeOptions KubeOptions) {
+	// the clients of the mounts were created by checkMetadata
+	if _, err := d.client(kubeOptions); err != nil {
+		fmt.Printf("Warning: Can't connect to cluster: %v\n", err)
+	}
+
+	checked := map[string]bool{}
+	for _, client := range d.clients {
+		if checked[client.Context] {
+			continue
+		}
+		checked[client.Context] = true
+
+		namespaces := []string{client.Namespace}
+		for _, meta := range d.metadata {
+			if meta.Context == client.Context && !slices.Contains(namespaces, meta.Namespace) {
+				namespaces = append(namespaces, meta.Namespace)
+			}
+		}
+
+		deployments, err := client.ListDeployments(ManagedSelector(false), namespaces)
+		if err != nil {
+			fmt.Printf("Warning: Can't check deployments in context %s: %v\n", client.Context, err)
+			continue
+		}
+
+		for i := range deployments {
+			server := newRemoteServer(&deployments[i])
+			name, namespace := server.Name, server.Namespace
+			deleteServer := func() error { return client.DeleteServerResources(name, namespace) }
+
+			if server.IsExpired(ExpiryGracePeriod) {
+				d.report(deleteServer, "deployment %s in namespace %s of context %s (created by %s) expired at %s",
+					name, namespace, client.Context, server.CreatedBy, server.ExpiresAt.Format(time.RFC3339))
+				continue
+			}
+			if !server.IsOwn() || server.FindMount(d.metadata, client.Context) != nil {
+				continue
+			}
+			d.report(deleteServer, "deployment %s in namespace %s of context %s doesn't belong to a mount", name, namespace, client.Context)
+		}
+	}
+}
+
+// killProcess stops a process, a process that already exited is not an error
+func killProcess(pid int) error {
+	err := syscall.Kill(pid, syscall.SIGTERM)
+	if err != nil && !errors.Is(err, syscall.ESRCH) {
+		return fmt.Errorf("failed to stop process %d: %v", pid, err)
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// FindPVCPod returns a running pod that mounts the given PVC
+func (c *KubeClient) FindPVCPod(pvcName string, namespace string) (*corev1.Pod, error) {
+	namespace = c.namespaceOrDefault(namespace)
+	users, err := c.getPVCUsers(pvcName, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range users {
+		if users[i].Status.Phase == corev1.PodRunning && users[i].DeletionTimestamp == nil {
+			return &users[i], nil
+		}
+	}
+
+	return nil, &KubeError{
+		Op:     "find pod",
+		Reason: ErrNotFound,
+		Err:    fmt.Errorf("no running pod mounts PVC %s", pvcName),
+	}
+}
+
+// GetPVCVolumeMount returns the volume of a pod backed by the given PVC, it has to be mounted by a container of the pod
+func GetPVCVolumeMount(pod *corev1.Pod, pvcName string) (volumeName string, err error) {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == pvcName {
+			volumeName = volume.Name
+			break
+		}
+	}
+	if volumeName == "" {
+		return "", fmt.Errorf("pod %s does not mount PVC %s", pod.Name, pvcName)
+	}
+
+	for _, container := range pod.Spec.Containers {
+		for _, mount := range container.VolumeMounts {
+			if mount.Name == volumeName {
+				return volumeName, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no container of pod %s mounts PVC %s", pod.Name, pvcName)
+}
+
+// GetFreePodPort returns the first port starting at the given one that is not used in the pod, see GetPodPorts.
+// Ephemeral containers share the network namespace of the pod, so their port must not collide with the application
+// or with servers injected earlier.
+func GetFreePodPort(pod *corev1.Pod, port int) int {
+	used := GetPodPorts(pod)
+	for used[port] {
+		port++
+	}
+	return port
+}
+
+// GetPodPorts returns the ports declared by the containers of the pod and the ports of servers injected
+// by earlier attaches that didn't terminate. Ephemeral containers can't declare ports, their ports are
+// taken from the rclone command line.
+func GetPodPorts(pod *corev1.Pod) map[int]bool {
+	ports := map[int]bool{}
+	for _, container := range pod.Spec.Containers {
+		for _, containerPort := range container.Ports {
+			ports[int(containerPort.ContainerPort)] = true
+		}
+	}
+
+	terminated := map[string]bool{}
+	for _, status := range pod.Status.EphemeralContainerStatuses {
+		terminated[status.Name] = status.State.Terminated != nil
+	}
+	for _, container := range pod.Spec.EphemeralContainers {
+		if !terminated[container.Name] {
+			addServerPorts(ports, append(container.Command, container.Args...))
+		}
+	}
+	return ports
+}
+
+// addServerPorts adds the ports of an rclone server command line, the listen address and the passive port range of FTP
+func addServerPorts(ports map[int]bool, args []string) {
+	for i := 0; i+1 < len(args); i++ {
+		switch args[i] {
+		case "--addr":
+			_, port, err := net.SplitHostPort(args[i+1])
+			if err != nil {
+				continue
+			}
+			if number, err := strconv.Atoi(port); err == nil {
+				ports[number] = true
+			}
+		case "--passive-port":
+			first, last, _ := strings.Cut(args[i+1], "-")
+			start, err := strconv.Atoi(first)
+			if err != nil {
+				continue
+			}
+			end, err := strconv.Atoi(last)
+			if err != nil {
+				end = start
+			}
+			for port := start; port <= end; port++ {
+				ports[port] = true
+			}
+		}
+	}
+}
+
+// AddEphemeralContainer injects an ephemeral container into a running pod
+func (c *KubeClient) AddEphemeralContainer(podName string, namespace string, container corev1.EphemeralContainer) error {
+	namespace = c.namespaceOrDefault(namespace)
+	ctx := context.Background()
+	pods := c.Clientset.CoreV1().Pods(namespace)
+
+	pod, err := pods.Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return wrapKubeError(fmt.Sprintf("get pod %s", podName), err)
+	}
+
+	pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, container)
+	if _, err := pods.UpdateEphemeralContainers(ctx, podName, pod, metav1.UpdateOptions{FieldManager: FieldManager}); err != nil {
+		return wrapKubeError(fmt.Sprintf("add ephemeral container to pod %s", podName), err)
+	}
+
+	return nil
+}
+
+// WaitForEphemeralContainer waits until an ephemeral container is running
+func (c *KubeClient) WaitForEphemeralContainer(podName string, namespace string, containerName string, timeoutSeconds int) error {
+	namespace = c.namespaceOrDefault(namespace)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSeconds)*time.Second)
+	defer cancel()
+
+	err := wait.PollUntilContextCancel(ctx, time.Second, true, func(ctx context.Context) (bool, error) {
+		pod, err := c.Clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		for _, status := range pod.Status.EphemeralContainerStatuses {
+			if status.Name != containerName {
+				continue
+			}
+			if status.State.Terminated != nil {
+				return false, fmt.Errorf("container %s terminated: %s %s",
+					containerName, status.State.Terminated.Reason, status.State.Terminated.Message)
+			}
+			return status.State.Running != nil, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return wrapKubeError(fmt.Sprintf("wait for container %s of pod %s", containerName, podName), err)
+	}
+
+	return nil
+}
+
+// IsEphemeralContainerRunning checks if an ephemeral container of a pod is running
+func IsEphemeralContainerRunning(pod *corev1.Pod, containerName string) bool {
+	for _, status := range pod.Status.EphemeralContainerStatuses {
+		if status.Name == containerName {
+			return status.State.Running != nil
+		}
+	}
+	return false
+}
+
+// ExecInContainer runs a command in a container of a pod and returns its combined output
+func (c *KubeClient) ExecInContainer(podName string, namespace string, containerName string, command []string) (string, error) {
+	namespace = c.namespaceOrDefault(namespace)
+	req := c.Clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: containerName,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	spdyExecutor, err := remotecommand.NewSPDYExecutor(c.Config, "POST", req.URL())
+	if err != nil {
+		return "", fmt.Errorf("failed to create SPDY executor: %v", err)
+	}
+	websocketExecutor, err := remotecommand.NewWebSocketExecutor(c.Config, "GET", req.URL().String())
+	if err != nil {
+		return "", fmt.Errorf("failed to create websocket executor: %v", err)
+	}
+	executor, err := remotecommand.NewFallbackExecutor(websocketExecutor, spdyExecutor, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create executor: %v", err)
+	}
+
+	var output bytes.Buffer
+	err = executor.StreamWithContext(context.Background(), remotecommand.StreamOptions{Stdout: &output, Stderr: &output})
+	if err != nil {
+		return output.String(), wrapKubeError(fmt.Sprintf("exec %s in pod %s", strings.Join(command, " "), podName), err)
+	}
+
+	return output.String(), nil
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Event types recorded by the mount daemon
+const (
+	EventDisconnected = "disconnected"
+	EventReconnected  = "reconnected"
+	EventRemounted    = "remounted"
+	EventMountFailed  = "mountFailed"
+	EventExpired      = "expired"
+)
+
+// Event is a single entry of the event log of a mount
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+}
+
+// GetEventsFilePath returns the path to the event log of the mount
+func (m *Metadata) GetEventsFilePath() string {
+	return filepath.Join(m.ConfigDir, "events.jsonl")
+}
+
+// RecordEvent appends an event to the event log of the mount
+func (m *Metadata) RecordEvent(eventType string, message string) error {
+	data, err := json.Marshal(Event{Time: time.Now(), Type: eventType, Message: message})
+	if err != nil {
+		return fmt.Errorf("error marshaling event: %v", err)
+	}
+
+	file, err := os.OpenFile(m.GetEventsFilePath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening event log: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing event: %v", err)
+	}
+
+	return nil
+}
+
+// LoadEvents reads the event log of the mount, a missing log is not an error
+func (m *Metadata) LoadEvents() ([]Event, error) {
+	file, err := os.Open(m.GetEventsFilePath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening event log: %v", err)
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		event := Event{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+
+	return events, scanner.Err()
+}
@@ -0,0 +1,269 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/willscott/go-nfs-client/nfs"
+)
+
+// ProbeTimeout limits every protocol probe of a health check
+const ProbeTimeout = 5 * time.Second
+
+// Results of a health check
+const (
+	HealthOK      = "ok"
+	HealthFailed  = "failed"
+	HealthSkipped = "skipped"
+)
+
+// HealthCheck is the result of a single check of a mount
+type HealthCheck struct {
+	Name    string
+	Status  string
+	Message string
+}
+
+// CheckHealth checks the server in the cluster, port forwarding, the local mount and the protocol of a mount
+func CheckHealth(meta *Metadata) []HealthCheck {
+	forwarding := checkPortForwarding(meta)
+	checks := []HealthCheck{checkServer(meta), forwarding, checkLocalMount(meta)}
+
+	if forwarding.Status == HealthOK {
+		checks = append(checks, checkProtocol(meta))
+	} else {
+		checks = append(checks, HealthCheck{Name: "protocol", Status: HealthSkipped, Message: "port forwarding is not running"})
+	}
+	return checks
+}
+
+// IsHealthy checks if none of the checks failed
+func IsHealthy(checks []HealthCheck) bool {
+	for _, check := range checks {
+		if check.Status == HealthFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// checkServer checks that the deployment is available and has a ready pod, or that the ephemeral container is running
+func checkServer(meta *Metadata) HealthCheck {
+	check := HealthCheck{Name: "server"}
+	fail := func(format string, args ...any) HealthCheck {
+		check.Status = HealthFailed
+		check.Message = fmt.Sprintf(format, args...)
+		return check
+	}
+
+	client, err := NewKubeClient(meta.KubeOptions)
+	if err != nil {
+		return fail("error connecting to cluster: %v", err)
+	}
+
+	if meta.AttachPod != "" {
+		pod, err := client.GetPod(meta.AttachPod, meta.Namespace)
+		if err != nil {
+			return fail("%v", err)
+		}
+		if !IsEphemeralContainerRunning(pod, meta.AttachContainer) {
+			return fail("container %s of pod %s is not running", meta.AttachContainer, meta.AttachPod)
+		}
+		check.Status = HealthOK
+		check.Message = fmt.Sprintf("container %s of pod %s is running", meta.AttachContainer, meta.AttachPod)
+		return check
+	}
+
+	deployment, err := client.GetDeployment(meta.ProvisionerName, meta.Namespace)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if !isDeploymentAvailable(deployment) {
+		return fail("deployment %s is not available", meta.ProvisionerName)
+	}
+	pod, err := client.GetReadyPod(fmt.Sprintf("app=%s", meta.ProvisionerName), meta.Namespace)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	check.Status = HealthOK
+	check.Message = fmt.Sprintf("deployment %s is available, pod %s is ready", meta.ProvisionerName, pod.Name)
+	return check
+}
+
+// checkPortForwarding checks that the daemon is running and the local port accepts connections
+func checkPortForwarding(meta *Metadata) HealthCheck {
+	check := HealthCheck{Name: "port forwarding", Status: HealthFailed}
+
+	if !IsProcessAlive(meta.PortForwardingPid) {
+		check.Message = fmt.Sprintf("daemon (pid %d) is not running", meta.PortForwardingPid)
+		return check
+	}
+	status, err := GetDaemonStatus(meta)
+	if err != nil {
+		check.Message = fmt.Sprintf("daemon (pid %d) doesn't respond: %v", meta.PortForwardingPid, err)
+		return check
+	}
+	if !CheckHostPort(meta.LocalHostname, meta.LocalPort, 1000) {
+		check.Message = fmt.Sprintf("port %d doesn't accept connections", meta.LocalPort)
+		return check
+	}
+
+	check.Status = HealthOK
+	check.Message = fmt.Sprintf("port %d is forwarded to pod %s by pid %d", meta.LocalPort, status.Pod, status.Pid)
+	if status.LastError != "" {
+		check.Message += fmt.Sprintf(", last error at %s: %s", status.LastErrorAt.Format(time.RFC3339), status.LastError)
+	}
+	return check
+}
+
+// checkLocalMount checks that the mount process is alive and the mount directory is a mount point
+func checkLocalMount(meta *Metadata) HealthCheck {
+	check := HealthCheck{Name: "mount", Status: HealthFailed}
+	mountDir := meta.GetMountDir()
+
+	if meta.MountMethod == "" {
+		check.Status = HealthSkipped
+		check.Message = "not mounted"
+		return check
+	}
+	// kernel mounts have no process
+	if meta.MountPid != 0 && !IsProcessAlive(meta.MountPid) {
+		check.Message = fmt.Sprintf("%s process (pid %d) is not running", meta.MountMethod, meta.MountPid)
+		return check
+	}
+	if !IsMountPoint(mountDir) {
+		check.Message = fmt.Sprintf("%s is not a mount point", mountDir)
+		return check
+	}
+
+	check.Status = HealthOK
+	check.Message = fmt.Sprintf("%s is mounted with %s", mountDir, meta.MountMethod)
+	return check
+}
+
+// checkProtocol probes the server through the forwarded port with the protocol of the provider
+func checkProtocol(meta *Metadata) HealthCheck {
+	check := HealthCheck{Name: "protocol"}
+
+	definition := LookupProvider(meta.ProviderType)
+	if definition == nil || definition.Probe == nil {
+		check.Status = HealthSkipped
+		check.Message = fmt.Sprintf("no probe for provider %s", meta.ProviderType)
+		return check
+	}
+
+	if err := definition.Probe(meta); err != nil {
+		check.Status = HealthFailed
+		check.Message = err.Error()
+		return check
+	}
+
+	check.Status = HealthOK
+	check.Message = fmt.Sprintf("%s server responds", meta.ProviderType)
+	return check
+}
+
+// probeHTTP sends an authenticated request to the server and expects the given status code
+func probeHTTP(meta *Metadata, method string, expectedStatus int) error {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if meta.TLS {
+		caCert, err := os.ReadFile(meta.GetCACertFilePath())
+		if err != nil {
+			return fmt.Errorf("error reading CA certificate: %v", err)
+		}
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(caCert)
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	client := &http.Client{Transport: transport, Timeout: ProbeTimeout}
+
+	request, err := http.NewRequest(method, meta.GetURL(), nil)
+	if err != nil {
+		return err
+	}
+	password, err := meta.GetDecodedPassword()
+	if err != nil {
+		return err
+	}
+	request.SetBasicAuth(meta.MountUsername, password)
+	if method == "PROPFIND" {
+		request.Header.Set("Depth", "0")
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %v", method, err)
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+
+	if expectedStatus != 0 && response.StatusCode != expectedStatus {
+		return fmt.Errorf("%s request returned %s, expected %d", method, response.Status, expectedStatus)
+	}
+	return nil
+}
+
+// probeGreeting connects to the server and expects its first line to start with the given prefix,
+// e.g. the version of SSH servers or the greeting of FTP servers
+func probeGreeting(meta *Metadata, prefix string) error {
+	address := net.JoinHostPort(meta.LocalHostname, strconv.Itoa(meta.LocalPort))
+	conn, err := net.DialTimeout("tcp", address, ProbeTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(ProbeTimeout))
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("no greeting received: %v", err)
+	}
+	if !strings.HasPrefix(line, prefix) {
+		return fmt.Errorf("unexpected greeting %q", strings.TrimSpace(line))
+	}
+	return nil
+}
+
+// probeNFS sends the NULL procedure of NFSv3 to the server.
+// The call is encoded by hand, the RPC client of the NFS library retries for a long time if the server doesn't answer.
+func probeNFS(meta *Metadata) error {
+	address := net.JoinHostPort(meta.LocalHostname, strconv.Itoa(meta.LocalPort))
+	conn, err := net.DialTimeout("tcp", address, ProbeTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(ProbeTimeout))
+
+	// record mark, xid, CALL, RPC version 2, program, version, procedure NULL, AUTH_NULL credentials and verifier
+	const xid = 0x6b766d00
+	call := []uint32{0x80000000 | 40, xid, 0, 2, nfs.Nfs3Prog, nfs.Nfs3Vers, 0, 0, 0, 0, 0}
+	if err := binary.Write(conn, binary.BigEndian, call); err != nil {
+		return fmt.Errorf("error sending NULL call: %v", err)
+	}
+
+	// record mark, xid, REPLY, MSG_ACCEPTED, verifier flavor and length (AUTH_NULL is empty), accept status
+	reply := make([]uint32, 7)
+	if err := binary.Read(conn, binary.BigEndian, reply); err != nil {
+		return fmt.Errorf("error reading NULL reply: %v", err)
+	}
+	if reply[1] != xid || reply[2] != 1 {
+		return errors.New("invalid reply to NULL call")
+	}
+	if reply[3] != 0 || reply[6] != 0 {
+		return fmt.Errorf("NULL call was rejected (reply state %d, accept state %d)", reply[3], reply[6])
+	}
+	return nil
+}
@@ -1,144 +1,527 @@
 package internal
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
-	"os/exec"
-	"strings"
-	"syscall"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/tools/portforward"
+	watchtools "k8s.io/client-go/tools/watch"
+	"k8s.io/client-go/transport/spdy"
 )
 
-// ApplyManifest applies a Kubernetes manifest file
-func ApplyManifest(manifestPath string) error {
-	cmd := exec.Command("kubectl", "apply", "-f", manifestPath)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to apply manifest: %v\nOutput: %s", err, string(output))
+// FieldManager is the field manager name used for server-side apply
+const FieldManager = "k8s-volume-mount"
+
+// Error classes returned by KubeClient, use errors.Is to check for them
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrForbidden = errors.New("forbidden")
+	ErrTimeout   = errors.New("timed out")
+)
+
+// KubeError is returned by all KubeClient methods that talk to the cluster
+type KubeError struct {
+	// Op describes the operation that failed
+	Op string
+
+	// Reason is one of ErrNotFound, ErrForbidden, ErrTimeout or nil if the error could not be classified
+	Reason error
+
+	// Err is the underlying error
+	Err error
+}
+
+func (e *KubeError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+func (e *KubeError) Unwrap() []error {
+	return []error{e.Reason, e.Err}
+}
+
+// wrapKubeError classifies an error returned by client-go
+func wrapKubeError(op string, err error) error {
+	if err == nil {
+		return nil
 	}
-	return nil
+
+	var reason error
+	switch {
+	case apierrors.IsNotFound(err):
+		reason = ErrNotFound
+	case apierrors.IsForbidden(err):
+		reason = ErrForbidden
+	case apierrors.IsTimeout(err), apierrors.IsServerTimeout(err),
+		errors.Is(err, context.DeadlineExceeded), wait.Interrupted(err):
+		reason = ErrTimeout
+	}
+
+	return &KubeError{Op: op, Reason: reason, Err: err}
 }
 
-// WaitForDeployment waits for a deployment to be ready
-func WaitForDeployment(deploymentName string, namespace string, timeoutSeconds int) error {
-	args := []string{"wait", "--for=condition=Available",
-		fmt.Sprintf("deployment/%s", deploymentName),
-		fmt.Sprintf("--timeout=%ds", timeoutSeconds)}
+// KubeOptions select the kubeconfig, context and identity used to talk to the cluster
+type KubeOptions struct {
+	Kubeconfig string   `json:"kubeconfig,omitempty"`
+	Context    string   `json:"context,omitempty"`
+	As         string   `json:"as,omitempty"`
+	AsGroups   []string `json:"asGroups,omitempty"`
+}
 
-	if namespace != "" {
-		args = append(args, "-n", namespace)
+// KubeClient is a client for all cluster interactions of k8s-volume-mount
+type KubeClient struct {
+	Config    *rest.Config
+	Clientset kubernetes.Interface
+	Dynamic   dynamic.Interface
+	Mapper    meta.RESTMapper
+
+	// Context is the name of the kubeconfig context in use
+	Context string
+
+	// Namespace is the default namespace of the kubeconfig context
+	Namespace string
+}
+
+// NewKubeClient creates a client using the default kubeconfig loading rules and the given overrides
+func NewKubeClient(options KubeOptions) (*KubeClient, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = options.Kubeconfig
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: options.Context,
+		AuthInfo: clientcmdapi.AuthInfo{
+			Impersonate:       options.As,
+			ImpersonateGroups: options.AsGroups,
+		},
 	}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
 
-	cmd := exec.Command("kubectl", args...)
+	rawConfig, err := clientConfig.RawConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %v", err)
+	}
+	contextName := options.Context
+	if contextName == "" {
+		contextName = rawConfig.CurrentContext
+	}
 
-	output, err := cmd.CombinedOutput()
+	config, err := clientConfig.ClientConfig()
 	if err != nil {
-		return fmt.Errorf("deployment not ready: %v\nOutput: %s", err, string(output))
+		return nil, fmt.Errorf("failed to load kubeconfig: %v", err)
 	}
-	return nil
+
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine namespace: %v", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %v", err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %v", err)
+	}
+
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(clientset.Discovery()))
+
+	return &KubeClient{
+		Config:    config,
+		Clientset: clientset,
+		Dynamic:   dynamicClient,
+		Mapper:    mapper,
+		Context:   contextName,
+		Namespace: namespace,
+	}, nil
 }
 
-// GetPodLogs retrieves logs from pods matching the given selector
-func GetPodLogs(selector string, namespace string) (string, error) {
-	// First get pod names
-	args := []string{"get", "pods", "-l", selector, "-o", "name"}
+// namespaceOrDefault returns the given namespace or the default namespace of the client
+func (c *KubeClient) namespaceOrDefault(namespace string) string {
 	if namespace != "" {
-		args = append(args, "-n", namespace)
+		return namespace
 	}
-	cmd := exec.Command("kubectl", args...)
-	output, err := cmd.CombinedOutput()
+	return c.Namespace
+}
+
+// ReadManifest parses a multi document YAML manifest file
+func ReadManifest(manifestPath string) ([]*unstructured.Unstructured, error) {
+	data, err := os.ReadFile(manifestPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to get pods: %v", err)
+		return nil, fmt.Errorf("failed to read manifest: %v", err)
 	}
 
-	podNames := strings.Split(strings.TrimSpace(string(output)), "\n")
-	if len(podNames) == 0 || (len(podNames) == 1 && podNames[0] == "") {
-		return "", fmt.Errorf("no pods found with selector: %s", selector)
+	var objects []*unstructured.Unstructured
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to decode manifest: %v", err)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+		objects = append(objects, obj)
 	}
 
-	// Get logs from the first pod
-	podName := strings.TrimPrefix(podNames[0], "pod/")
-	logArgs := []string{"logs", podName}
-	if namespace != "" {
-		logArgs = append(logArgs, "-n", namespace)
+	return objects, nil
+}
+
+// resourceFor returns the dynamic resource interface for an object
+func (c *KubeClient) resourceFor(obj *unstructured.Unstructured) (dynamic.ResourceInterface, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := c.Mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find resource for %s: %v", gvk, err)
 	}
-	cmd = exec.Command("kubectl", logArgs...)
-	output, err = cmd.CombinedOutput()
+
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		namespace := c.namespaceOrDefault(obj.GetNamespace())
+		obj.SetNamespace(namespace)
+		return c.Dynamic.Resource(mapping.Resource).Namespace(namespace), nil
+	}
+
+	return c.Dynamic.Resource(mapping.Resource), nil
+}
+
+// ApplyManifest applies a Kubernetes manifest file using server-side apply
+func (c *KubeClient) ApplyManifest(manifestPath string) error {
+	objects, err := ReadManifest(manifestPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to get logs: %v", err)
+		return err
 	}
 
-	return string(output), nil
+	ctx := context.Background()
+	for _, obj := range objects {
+		resource, err := c.resourceFor(obj)
+		if err != nil {
+			return err
+		}
+
+		_, err = resource.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{FieldManager: FieldManager, Force: true})
+		if err != nil {
+			return wrapKubeError(fmt.Sprintf("apply %s %s", obj.GetKind(), obj.GetName()), err)
+		}
+	}
+
+	return nil
 }
 
-// StartPortForwarding starts port forwarding to a Kubernetes service
-func StartPortForwarding(serviceName string, namespace string, localPort int, remotePort int, logPath string) (pid int, err error) {
-	// Create a command to run port forwarding
-	args := []string{"port-forward",
-		fmt.Sprintf("svc/%s", serviceName),
-		fmt.Sprintf("%d:%d", localPort, remotePort)}
+// DeleteManifest deletes Kubernetes resources defined in a manifest file
+// Resources that do not exist anymore are skipped
+func (c *KubeClient) DeleteManifest(manifestPath string) error {
+	objects, err := ReadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
 
-	if namespace != "" {
-		args = append(args, "-n", namespace)
+	ctx := context.Background()
+	propagation := metav1.DeletePropagationBackground
+	var errs []error
+	for _, obj := range objects {
+		resource, err := c.resourceFor(obj)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		err = resource.Delete(ctx, obj.GetName(), metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, wrapKubeError(fmt.Sprintf("delete %s %s", obj.GetKind(), obj.GetName()), err))
+		}
 	}
 
-	cmd := exec.Command("kubectl", args...)
+	return errors.Join(errs...)
+}
 
-	// Redirect output to log file
-	logFile, err := os.Create(logPath)
-	defer func(logFile *os.File) {
-		err := logFile.Close()
+// GetDeployment returns a deployment by name
+func (c *KubeClient) GetDeployment(deploymentName string, namespace string) (*appsv1.Deployment, error) {
+	namespace = c.namespaceOrDefault(namespace)
+	deployment, err := c.Clientset.AppsV1().Deployments(namespace).Get(context.Background(), deploymentName, metav1.GetOptions{})
+	if err != nil {
+		return nil, wrapKubeError(fmt.Sprintf("get deployment %s", deploymentName), err)
+	}
+	return deployment, nil
+}
+
+// ListDeployments returns the deployments matching a selector in all namespaces.
+// If the user may not list deployments cluster-wide, only the given namespaces are searched.
+func (c *KubeClient) ListDeployments(selector string, namespaces []string) ([]appsv1.Deployment, error) {
+	options := metav1.ListOptions{LabelSelector: selector}
+	deployments, err := c.Clientset.AppsV1().Deployments(metav1.NamespaceAll).List(context.Background(), options)
+	if err == nil {
+		return deployments.Items, nil
+	}
+	if !apierrors.IsForbidden(err) {
+		return nil, wrapKubeError("list deployments", err)
+	}
+
+	var result []appsv1.Deployment
+	for _, namespace := range namespaces {
+		deployments, err := c.ListNamespaceDeployments(selector, namespace)
 		if err != nil {
-			fmt.Printf("warning: failed to close log file %s: %v\n", logPath, err)
+			return nil, err
 		}
-	}(logFile)
+		result = append(result, deployments...)
+	}
+	return result, nil
+}
+
+// ListNamespaceDeployments returns the deployments matching a selector in a namespace
+func (c *KubeClient) ListNamespaceDeployments(selector string, namespace string) ([]appsv1.Deployment, error) {
+	namespace = c.namespaceOrDefault(namespace)
+	options := metav1.ListOptions{LabelSelector: selector}
+	deployments, err := c.Clientset.AppsV1().Deployments(namespace).List(context.Background(), options)
 	if err != nil {
-		return pid, fmt.Errorf("failed to create log file: %v", err)
+		return nil, wrapKubeError(fmt.Sprintf("list deployments in namespace %s", namespace), err)
 	}
+	return deployments.Items, nil
+}
 
-	cmd.Stdout = logFile
-	cmd.Stderr = logFile
+// DeleteServerResources deletes the deployment of a server and the service, network policy, secret and lease belonging to it
+func (c *KubeClient) DeleteServerResources(name string, namespace string) error {
+	namespace = c.namespaceOrDefault(namespace)
+	ctx := context.Background()
+	propagation := metav1.DeletePropagationBackground
+	options := metav1.DeleteOptions{PropagationPolicy: &propagation}
 
-	// Set the command to run in its own process group
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Setpgid: true,
+	deletes := []struct {
+		kind   string
+		delete func() error
+	}{
+		{"deployment", func() error { return c.Clientset.AppsV1().Deployments(namespace).Delete(ctx, name, options) }},
+		{"service", func() error { return c.Clientset.CoreV1().Services(namespace).Delete(ctx, name, options) }},
+		{"network policy", func() error { return c.Clientset.NetworkingV1().NetworkPolicies(namespace).Delete(ctx, name, options) }},
+		{"secret", func() error { return c.Clientset.CoreV1().Secrets(namespace).Delete(ctx, name, options) }},
+		{"lease", func() error { return c.Clientset.BatchV1().Jobs(namespace).Delete(ctx, LeaseName(name), options) }},
 	}
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		return pid, fmt.Errorf("failed to start port forwarding: %v", err)
+	var errs []error
+	for _, resource := range deletes {
+		if err := resource.delete(); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, wrapKubeError(fmt.Sprintf("delete %s %s", resource.kind, name), err))
+		}
 	}
-	pid = cmd.Process.Pid
+	return errors.Join(errs...)
+}
 
-	// Release the process so it continues running after this program exits
-	if err := cmd.Process.Release(); err != nil {
-		return pid, fmt.Errorf("failed to release port forwarding process: %v", err)
+// WaitForDeployment watches a deployment until it is available
+func (c *KubeClient) WaitForDeployment(deploymentName string, namespace string, timeoutSeconds int) error {
+	namespace = c.namespaceOrDefault(namespace)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSeconds)*time.Second)
+	defer cancel()
+
+	deployments := c.Clientset.AppsV1().Deployments(namespace)
+	fieldSelector := fields.OneTermEqualSelector("metadata.name", deploymentName).String()
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fieldSelector
+			return deployments.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fieldSelector
+			return deployments.Watch(ctx, options)
+		},
 	}
 
-	isReachable := CheckHostPort("127.0.0.1", localPort, 5000)
-	if !isReachable {
-		return pid, fmt.Errorf("port forwarding not reachable")
+	_, err := watchtools.UntilWithSync(ctx, lw, &appsv1.Deployment{}, nil, func(event watch.Event) (bool, error) {
+		if event.Type == watch.Deleted {
+			return false, apierrors.NewNotFound(appsv1.Resource("deployments"), deploymentName)
+		}
+
+		deployment, ok := event.Object.(*appsv1.Deployment)
+		if !ok {
+			return false, nil
+		}
+
+		return isDeploymentAvailable(deployment), nil
+	})
+	if err != nil {
+		return wrapKubeError(fmt.Sprintf("wait for deployment %s", deploymentName), err)
 	}
 
-	return pid, nil
+	return nil
+}
+
+// isDeploymentAvailable checks if the latest generation of a deployment is rolled out and available
+func isDeploymentAvailable(deployment *appsv1.Deployment) bool {
+	if deployment.Status.ObservedGeneration < deployment.Generation {
+		return false
+	}
+
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentAvailable {
+			return condition.Status == corev1.ConditionTrue && deployment.Status.AvailableReplicas > 0
+		}
+	}
+
+	return false
+}
+
+// GetPodLogs retrieves logs from the first pod matching the given selector
+func (c *KubeClient) GetPodLogs(selector string, namespace string) (string, error) {
+	namespace = c.namespaceOrDefault(namespace)
+	ctx := context.Background()
+
+	pods, err := c.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return "", wrapKubeError("list pods", err)
+	}
+
+	if len(pods.Items) == 0 {
+		return "", &KubeError{
+			Op:     "get pod logs",
+			Reason: ErrNotFound,
+			Err:    fmt.Errorf("no pods found with selector: %s", selector),
+		}
+	}
+
+	podName := pods.Items[0].Name
+	logs, err := c.Clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{}).DoRaw(ctx)
+	if err != nil {
+		return "", wrapKubeError(fmt.Sprintf("get logs of pod %s", podName), err)
+	}
+
+	return string(logs), nil
 }
 
 // CheckPVCExists checks if a PVC exists in the cluster
-func CheckPVCExists(pvcName string, namespace string) bool {
-	args := []string{"get", "pvc", pvcName}
-	if namespace != "" {
-		args = append(args, "-n", namespace)
+// A KubeError with reason ErrNotFound is returned if it does not exist
+func (c *KubeClient) CheckPVCExists(pvcName string, namespace string) error {
+	namespace = c.namespaceOrDefault(namespace)
+	_, err := c.Clientset.CoreV1().PersistentVolumeClaims(namespace).Get(context.Background(), pvcName, metav1.GetOptions{})
+	return wrapKubeError(fmt.Sprintf("get pvc %s", pvcName), err)
+}
+
+// GetReadyPod returns a running and ready pod matching the given selector
+func (c *KubeClient) GetReadyPod(selector string, namespace string) (*corev1.Pod, error) {
+	namespace = c.namespaceOrDefault(namespace)
+	pods, err := c.Clientset.CoreV1().Pods(namespace).List(context.Background(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, wrapKubeError("list pods", err)
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp == nil && pod.Status.Phase == corev1.PodRunning && isPodReady(pod) {
+			return pod, nil
+		}
+	}
+
+	return nil, &KubeError{
+		Op:     "find ready pod",
+		Reason: ErrNotFound,
+		Err:    fmt.Errorf("no ready pod found with selector: %s", selector),
 	}
-	cmd := exec.Command("kubectl", args...)
-	err := cmd.Run()
-	return err == nil
 }
 
-// DeleteManifest deletes Kubernetes resources defined in a manifest file
-func DeleteManifest(manifestPath string) error {
-	cmd := exec.Command("kubectl", "delete", "-f", manifestPath, "--wait=false")
-	output, err := cmd.CombinedOutput()
+// isPodReady checks the Ready condition of a pod
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// DialPortForward opens a port forwarding stream connection to a pod
+// WebSockets are preferred, SPDY is used if the API server does not support tunneling
+func (c *KubeClient) DialPortForward(podName string, namespace string) (httpstream.Connection, error) {
+	namespace = c.namespaceOrDefault(namespace)
+	req := c.Clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("portforward")
+
+	transport, upgrader, err := spdy.RoundTripperFor(c.Config)
 	if err != nil {
-		return fmt.Errorf("failed to delete resources: %v\nOutput: %s", err, string(output))
+		return nil, fmt.Errorf("failed to create SPDY round tripper: %v", err)
 	}
-	return nil
+	spdyDialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+
+	websocketDialer, err := portforward.NewSPDYOverWebsocketDialer(req.URL(), c.Config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create websocket dialer: %v", err)
+	}
+
+	dialer := portforward.NewFallbackDialer(websocketDialer, spdyDialer, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+
+	conn, _, err := dialer.Dial(portforward.PortForwardProtocolV1Name)
+	if err != nil {
+		return nil, wrapKubeError(fmt.Sprintf("port forward to pod %s", podName), err)
+	}
+
+	return conn, nil
+}
+
+// GetPod returns a pod by name
+func (c *KubeClient) GetPod(podName string, namespace string) (*corev1.Pod, error) {
+	namespace = c.namespaceOrDefault(namespace)
+	pod, err := c.Clientset.CoreV1().Pods(namespace).Get(context.Background(), podName, metav1.GetOptions{})
+	if err != nil {
+		return nil, wrapKubeError(fmt.Sprintf("get pod %s", podName), err)
+	}
+	return pod, nil
+}
+
+// GetPodWarnings returns the warning events of the pods matching the given selector, e.g. failed volume attachments
+func (c *KubeClient) GetPodWarnings(selector string, namespace string) ([]string, error) {
+	namespace = c.namespaceOrDefault(namespace)
+	ctx := context.Background()
+
+	pods, err := c.Clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, wrapKubeError("list pods", err)
+	}
+
+	var warnings []string
+	for _, pod := range pods.Items {
+		fieldSelector := fields.Set{
+			"involvedObject.kind": "Pod",
+			"involvedObject.name": pod.Name,
+			"type":                corev1.EventTypeWarning,
+		}.AsSelector().String()
+		events, err := c.Clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{FieldSelector: fieldSelector})
+		if err != nil {
+			return nil, wrapKubeError(fmt.Sprintf("list events of pod %s", pod.Name), err)
+		}
+		for _, event := range events.Items {
+			warnings = append(warnings, fmt.Sprintf("%s: %s: %s", pod.Name, event.Reason, event.Message))
+		}
+	}
+
+	return warnings, nil
 }
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"os"
+	"os/user"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Labels of the resources created in the cluster
+const (
+	// ManagedByLabel marks resources created by this tool
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "k8s-volume-mount"
+
+	// VersionLabel is the version of the tool that created a resource
+	VersionLabel = "app.kubernetes.io/version"
+
+	// ClientLabel identifies the user and host that created a resource, doctor only repairs resources of its own client
+	ClientLabel = "k8s-volume-mount/client"
+
+	// PVCLabel and ProviderLabel select the servers of a PVC and provider
+	PVCLabel      = "k8s-volume-mount/pvc"
+	ProviderLabel = "k8s-volume-mount/provider"
+)
+
+// Annotations of the resources created in the cluster, for values that aren't valid label values
+const (
+	// PVCAnnotation is the full name of the PVC, the label is shortened to 63 characters
+	PVCAnnotation       = "k8s-volume-mount/pvc"
+	SubPathAnnotation   = "k8s-volume-mount/sub-path"
+	CreatedByAnnotation = "k8s-volume-mount/created-by"
+	CreatedAtAnnotation = "k8s-volume-mount/created-at"
+
+	// ExpiresAtAnnotation is the time a server with a TTL or idle timeout removes itself, unless it is renewed
+	ExpiresAtAnnotation = "k8s-volume-mount/expires-at"
+)
+
+var invalidLabelChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// currentUserAndHost returns the name of the current user and the hostname
+func currentUserAndHost() (string, string) {
+	username := "unknown"
+	if current, err := user.Current(); err == nil {
+		username = current.Username
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return username, hostname
+}
+
+// ClientID returns the user and host running this tool as label value
+func ClientID() string {
+	username, hostname := currentUserAndHost()
+	return toLabelValue(username + "." + hostname)
+}
+
+// toLabelValue replaces characters that aren't allowed in label values and shortens the value to 63 characters
+func toLabelValue(value string) string {
+	value = invalidLabelChars.ReplaceAllString(value, "_")
+	value = truncate(value, 63)
+	return strings.Trim(value, "._-")
+}
+
+// ManagedLabels returns the labels of the deployment, service and pods of a mount
+func ManagedLabels(meta *Metadata) map[string]string {
+	return map[string]string{
+		ManagedByLabel: ManagedByValue,
+		VersionLabel:   toLabelValue(GetVersion()),
+		ClientLabel:    ClientID(),
+		PVCLabel:       toLabelValue(meta.PVCName),
+		ProviderLabel:  meta.ProviderType,
+	}
+}
+
+// ManagedAnnotations returns the annotations of the deployment, service and pods of a mount
+func ManagedAnnotations(meta *Metadata) map[string]string {
+	username, hostname := currentUserAndHost()
+	annotations := map[string]string{
+		PVCAnnotation:       meta.PVCName,
+		CreatedByAnnotation: username + "@" + hostname,
+		CreatedAtAnnotation: time.Now().UTC().Format(time.RFC3339),
+	}
+	if meta.SubPath != "" {
+		annotations[SubPathAnnotation] = meta.SubPath
+	}
+	return annotations
+}
+
+// ManagedSelector selects the resources created by this tool, only those of this client if own is set
+func ManagedSelector(own bool) string {
+	selector := ManagedByLabel + "=" + ManagedByValue
+	if own {
+		selector += "," + ClientLabel + "=" + ClientID()
+	}
+	return selector
+}
@@ -0,0 +1,199 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	batchv1ac "k8s.io/client-go/applyconfigurations/batch/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+)
+
+// A server with a TTL or idle timeout is owned by a lease, a Job that never starts a pod (parallelism 0).
+// The job controller fails the job when its activeDeadlineSeconds pass and the TTL controller deletes it right away,
+// the garbage collector then deletes the deployment, service, network policy and secret owned by it.
+// No permissions besides creating jobs are needed, and the server is removed even if the client never comes back.
+// Renewing moves the deadline of the job.
+
+// ExpiryGracePeriod is the time the garbage collection of an expired server may take,
+// doctor deletes servers that outlived their expiry by more than this period
+const ExpiryGracePeriod = 5 * time.Minute
+
+// HasLease checks if the server of a mount expires
+func (m *Metadata) HasLease() bool {
+	return m.TTL > 0 || m.IdleTimeout > 0
+}
+
+// GetExpiry returns the time the server of a mount expires if it isn't renewed:
+// at the end of its TTL, or after the idle timeout if that is earlier. The zero time if it doesn't expire.
+func (m *Metadata) GetExpiry(renewedAt time.Time) time.Time {
+	var expiry time.Time
+	if m.TTL > 0 {
+		expiry = m.ExpiresAt
+	}
+	if m.IdleTimeout > 0 {
+		idleExpiry := renewedAt.Add(m.IdleTimeout)
+		if expiry.IsZero() || idleExpiry.Before(expiry) {
+			expiry = idleExpiry
+		}
+	}
+	return expiry
+}
+
+// LeaseRenewInterval returns how often the daemon of a mount renews a server with an idle timeout
+func LeaseRenewInterval(idleTimeout time.Duration) time.Duration {
+	return max(idleTimeout/4, SupervisorInterval)
+}
+
+// LeaseName returns the name of the lease of a server, job names are limited to 63 characters
+func LeaseName(provisionerName string) string {
+	return strings.TrimRight(truncate(provisionerName, 57), "-") + "-lease"
+}
+
+// deadlineSeconds returns the activeDeadlineSeconds of a job started at startTime that ends at expiry
+func deadlineSeconds(startTime time.Time, expiry time.Time) int64 {
+	seconds := int64(math.Ceil(expiry.Sub(startTime).Seconds()))
+	return max(seconds, 1)
+}
+
+// ApplyLease creates or updates the lease of a server and returns the owner reference for the resources of the server
+func (c *KubeClient) ApplyLease(meta *Metadata, expiry time.Time) (*metav1.OwnerReference, error) {
+	namespace := c.namespaceOrDefault(meta.Namespace)
+	name := LeaseName(meta.ProvisionerName)
+
+	// the pod template is required but never used
+	template := corev1ac.PodTemplateSpec().
+		WithSpec(corev1ac.PodSpec().
+			WithRestartPolicy(corev1.RestartPolicyNever).
+			WithContainers(corev1ac.Container().
+				WithName("lease").
+				WithImage(meta.Pod.GetImage()).
+				WithCommand("true")))
+
+	annotations := ManagedAnnotations(meta)
+	annotations[ExpiresAtAnnotation] = expiry.UTC().Format(time.RFC3339)
+	job := batchv1ac.Job(name, namespace).
+		WithLabels(ManagedLabels(meta)).
+		WithAnnotations(annotations).
+		WithSpec(batchv1ac.JobSpec().
+			WithParallelism(0).
+			WithBackoffLimit(0).
+			WithTTLSecondsAfterFinished(0).
+			WithActiveDeadlineSeconds(deadlineSeconds(time.Now(), expiry)).
+			WithTemplate(template))
+
+	applied, err := c.Clientset.BatchV1().Jobs(namespace).Apply(context.Background(), job, metav1.ApplyOptions{FieldManager: FieldManager, Force: true})
+	if err != nil {
+		return nil, wrapKubeError(fmt.Sprintf("apply lease %s", name), err)
+	}
+
+	owner := OwnerReferenceFor(applied, batchv1.SchemeGroupVersion.WithKind("Job"))
+	return &owner, nil
+}
+
+// RenewLease moves the expiry of a server and updates the expiry annotation of its deployment
+func (c *KubeClient) RenewLease(meta *Metadata, expiry time.Time) error {
+	namespace := c.namespaceOrDefault(meta.Namespace)
+	name := LeaseName(meta.ProvisionerName)
+	ctx := context.Background()
+
+	job, err := c.Clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return wrapKubeError(fmt.Sprintf("get lease %s", name), err)
+	}
+	if isJobFinished(job) {
+		return fmt.Errorf("lease %s already expired", name)
+	}
+
+	// the deadline counts from the start of the job
+	startTime := job.CreationTimestamp.Time
+	if job.Status.StartTime != nil {
+		startTime = job.Status.StartTime.Time
+	}
+
+	annotations := map[string]any{ExpiresAtAnnotation: expiry.UTC().Format(time.RFC3339)}
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": annotations},
+		"spec":     map[string]any{"activeDeadlineSeconds": deadlineSeconds(startTime, expiry)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.Clientset.BatchV1().Jobs(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: FieldManager})
+	if err != nil {
+		return wrapKubeError(fmt.Sprintf("renew lease %s", name), err)
+	}
+
+	// list -remote shows the expiry of the deployment
+	patch, err = json.Marshal(map[string]any{
+		"metadata": map[string]any{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.Clientset.AppsV1().Deployments(namespace).Patch(ctx, meta.ProvisionerName, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: FieldManager})
+	if err != nil {
+		return wrapKubeError(fmt.Sprintf("annotate deployment %s", meta.ProvisionerName), err)
+	}
+	return nil
+}
+
+// isJobFinished checks if a job completed or failed
+func isJobFinished(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) && condition.Status == corev1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteLease deletes the lease of a server, a lease that doesn't exist is not an error
+func (c *KubeClient) DeleteLease(provisionerName string, namespace string) error {
+	namespace = c.namespaceOrDefault(namespace)
+	name := LeaseName(provisionerName)
+
+	propagation := metav1.DeletePropagationBackground
+	err := c.Clientset.BatchV1().Jobs(namespace).Delete(context.Background(), name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return wrapKubeError(fmt.Sprintf("delete lease %s", name), err)
+	}
+	return nil
+}
+
+// RenewServer extends the lifetime of the server of a mount by its TTL, or by the given TTL if it is set
+func RenewServer(meta *Metadata, ttl time.Duration) (time.Time, error) {
+	if !meta.HasLease() {
+		return time.Time{}, fmt.Errorf("the server of %s doesn't expire, mount it with -ttl or -idle-timeout", meta.Key())
+	}
+
+	now := time.Now()
+	if ttl > 0 {
+		meta.TTL = ttl
+	}
+	if meta.TTL > 0 {
+		meta.ExpiresAt = now.Add(meta.TTL)
+	}
+	expiry := meta.GetExpiry(now)
+
+	client, err := NewKubeClient(meta.KubeOptions)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error connecting to cluster: %v", err)
+	}
+	if err := client.RenewLease(meta, expiry); err != nil {
+		return time.Time{}, err
+	}
+
+	if err := meta.Save(); err != nil {
+		return time.Time{}, fmt.Errorf("error saving metadata: %v", err)
+	}
+	return expiry, nil
+}
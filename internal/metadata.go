@@ -5,8 +5,12 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
 )
 
 // Metadata represents the structure for storing mount metadata
@@ -19,16 +23,45 @@ type Metadata struct {
 	LocalHostname     string `json:"localHostname"`
 	LocalPort         int    `json:"localPort"`
 	RemotePort        int    `json:"remotePort"`
+	ForwardedPorts    []int  `json:"forwardedPorts,omitempty"`
 	PortForwardingPid int    `json:"portForwardingPid,omitempty"`
 	MountMethod       string `json:"mountMethod"`
 	MountPid          int    `json:"mountPid,omitempty"`
+	Unmounted         bool   `json:"unmounted,omitempty"`
 	MountUsername     string `json:"mountUsername"`
-	MountPassword     string `json:"mountPassword"`
+	CredentialStore   string `json:"credentialStore,omitempty"`
 	ProvisionerName   string `json:"provisionerName"`
+	NodeName          string `json:"nodeName,omitempty"`
+	AttachPod         string `json:"attachPod,omitempty"`
+	AttachContainer   string `json:"attachContainer,omitempty"`
+	ReadOnly          bool   `json:"readOnly,omitempty"`
+	SubPath           string `json:"subPath,omitempty"`
+	TLS               bool   `json:"tls,omitempty"`
+	SFTPAuth          string `json:"sftpAuth,omitempty"`
+	NetworkPolicy     bool   `json:"networkPolicy,omitempty"`
+
+	// TTL is the lifetime of the server, it expires at ExpiresAt unless it is renewed
+	TTL       time.Duration `json:"ttl,omitempty"`
+	ExpiresAt time.Time     `json:"expiresAt,omitzero"`
+
+	// IdleTimeout removes the server if no client connected to the forwarded ports for this duration
+	IdleTimeout time.Duration `json:"idleTimeout,omitempty"`
+
+	// Pod customizes the pod running the server
+	Pod PodOptions `json:"pod"`
+
+	// KubeOptions used for the mount, all later cluster interactions reuse them
+	KubeOptions
+
+	// MountPassword is the base64 encoded password stored by former versions, it is moved to the credential store on save
+	MountPassword string `json:"mountPassword,omitempty"`
+
+	// password is kept in memory until it is stored in the credential store
+	password string
 }
 
 // NewMetadata creates a new metadata instance for a specific provisioner
-func NewMetadata(providerType string, pvcName string, port int) *Metadata {
+func NewMetadata(providerType string, key SessionKey, port int) *Metadata {
 	username, err := GenerateRandomString(8)
 	if err != nil {
 		err = fmt.Errorf("failed to generate random username: %v", err)
@@ -41,23 +74,30 @@ func NewMetadata(providerType string, pvcName string, port int) *Metadata {
 		panic(err)
 	}
 
-	// Encode password in base64
-	encodedPassword := base64.StdEncoding.EncodeToString([]byte(password))
-
 	meta := &Metadata{
 		ProviderType:    providerType,
-		ProvisionerName: fmt.Sprintf("%s-%s-%d", providerType, pvcName, port),
-		ConfigDir:       GetConfigDir(pvcName),
-		PVCName:         pvcName,
+		ProvisionerName: fmt.Sprintf("%s-%s-%d", providerType, key.PVCName, port),
+		ConfigDir:       GetConfigDir(key),
+		PVCName:         key.PVCName,
+		Namespace:       key.Namespace,
+		SubPath:         key.SubPath,
+		KubeOptions:     KubeOptions{Context: key.Context},
 		LocalHostname:   "127.0.0.1",
 		LocalPort:       port,
-		RemotePort:      8090,
+		RemotePort:      DefaultRemotePort,
 		MountUsername:   username,
-		MountPassword:   encodedPassword,
+		password:        password,
+	}
+
+	if definition := LookupProvider(providerType); definition != nil {
+		meta.RemotePort = definition.GetRemotePort()
 	}
 
 	configFilePath := meta.GetConfigFilePath()
-	_ = meta.Load(configFilePath)
+	if err := meta.Load(configFilePath); err == nil {
+		// an existing mount keeps its stored password
+		meta.password = ""
+	}
 
 	return meta
 }
@@ -79,8 +119,9 @@ func GenerateRandomString(n int) (string, error) {
 	return string(b), nil
 }
 
-func GetConfigDir(pvcName string) string {
-	return filepath.Join(TempDir, pvcName)
+// GetConfigDir returns the directory storing the state of a mount
+func GetConfigDir(key SessionKey) string {
+	return filepath.Join(TempDir, key.Path())
 }
 
 // GetConfigFilePath returns the path to the metadata configuration file
@@ -93,10 +134,10 @@ func (m *Metadata) GetMountDir() string {
 		return m.CustomMountDir
 	}
 
-	return filepath.Join(MountBaseDir, m.PVCName)
+	return filepath.Join(MountBaseDir, m.Key().Path())
 }
 
-// Save stores metadata to a JSON file at the default location
+// Save stores metadata to a JSON file at the default location, the password is stored in the credential store
 func (m *Metadata) Save() error {
 	path := m.GetConfigFilePath()
 
@@ -105,19 +146,106 @@ func (m *Metadata) Save() error {
 		return fmt.Errorf("error creating directory: %v", err)
 	}
 
+	if err := m.storePassword(); err != nil {
+		return err
+	}
+
+	unlock, err := m.lockConfig()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return m.write()
+}
+
+// SaveMountPid records the pid of a new mount process. Only the pid is changed,
+// the other fields are kept as they are in the config file.
+func (m *Metadata) SaveMountPid(pid int) error {
+	unlock, err := m.lockConfig()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current := &Metadata{}
+	if err := current.Load(m.GetConfigFilePath()); err != nil {
+		return err
+	}
+	current.MountPid = pid
+	m.MountPid = pid
+	return current.write()
+}
+
+// write replaces the config file, readers never see a partially written file
+func (m *Metadata) write() error {
+	path := m.GetConfigFilePath()
 	data, err := json.MarshalIndent(m, "", "  ")
 	if err != nil {
 		return fmt.Errorf("error marshaling metadata: %v", err)
 	}
 
-	// Write to file
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	// a new file is only readable by the user, files of former versions were readable by everyone
+	file, err := os.CreateTemp(filepath.Dir(path), "config.json.*")
+	if err != nil {
+		return fmt.Errorf("error saving metadata: %v", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
 		return fmt.Errorf("error saving metadata: %v", err)
 	}
 
 	return nil
 }
 
+// lockConfig locks the config file of the mount against concurrent writers, the returned function releases the lock
+func (m *Metadata) lockConfig() (func(), error) {
+	file, err := os.OpenFile(filepath.Join(m.ConfigDir, "config.lock"), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error locking metadata: %v", err)
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("error locking metadata: %v", err)
+	}
+	return func() {
+		_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		_ = file.Close()
+	}, nil
+}
+
+// storePassword moves a password that is only kept in memory or in the config file of a former version to the credential store
+func (m *Metadata) storePassword() error {
+	if m.MountPassword != "" {
+		password, err := m.GetDecodedPassword()
+		if err != nil {
+			return err
+		}
+		m.password = password
+	}
+	if m.password == "" || m.CredentialStore != "" {
+		return nil
+	}
+
+	store, err := DefaultCredentialStore()
+	if err != nil {
+		return err
+	}
+	if err := store.Set(m.ConfigDir, "k8s-volume-mount "+m.Key().String(), m.password); err != nil {
+		return fmt.Errorf("error storing password in %s credential store: %v", store.Name(), err)
+	}
+	m.CredentialStore = store.Name()
+	m.MountPassword = ""
+	return nil
+}
+
 // Load retrieves metadata from a JSON file
 func (m *Metadata) Load(path string) error {
 	if _, err := os.Stat(path); err != nil {
@@ -136,9 +264,22 @@ func (m *Metadata) Load(path string) error {
 	return nil
 }
 
-// Delete removes the metadata file
+// Delete removes the metadata file and the stored password
 func (m *Metadata) Delete() error {
-	return os.RemoveAll(m.ConfigDir)
+	if m.CredentialStore != "" {
+		store, err := NewCredentialStore(m.CredentialStore)
+		if err == nil {
+			err = store.Delete(m.ConfigDir)
+		}
+		if err != nil {
+			fmt.Printf("Warning: Error deleting password from %s credential store: %v\n", m.CredentialStore, err)
+		}
+	}
+	if err := os.RemoveAll(m.ConfigDir); err != nil {
+		return err
+	}
+	removeEmptyParents(m.ConfigDir, TempDir)
+	return nil
 }
 
 // GetLogFilePath returns the path to the log file
@@ -146,11 +287,45 @@ func (m *Metadata) GetLogFilePath() string {
 	return filepath.Join(TempDir, m.ProvisionerName+".log")
 }
 
-// GetDecodedPassword returns the decoded password
+// GetURL returns the URL of the forwarded server, for providers speaking HTTP
+func (m *Metadata) GetURL() string {
+	scheme := "http"
+	if m.TLS {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/", scheme, net.JoinHostPort(m.LocalHostname, strconv.Itoa(m.LocalPort)))
+}
+
+// GetCACertFilePath returns the path to the CA certificate of the server, used if TLS is enabled
+func (m *Metadata) GetCACertFilePath() string {
+	return filepath.Join(m.ConfigDir, "ca.crt")
+}
+
+// GetDecodedPassword returns the password of the mount, it is read from the credential store once
 func (m *Metadata) GetDecodedPassword() (string, error) {
-	decodedBytes, err := base64.StdEncoding.DecodeString(m.MountPassword)
+	if m.password != "" {
+		return m.password, nil
+	}
+
+	if m.MountPassword != "" {
+		decodedBytes, err := base64.StdEncoding.DecodeString(m.MountPassword)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode password: %v", err)
+		}
+		return string(decodedBytes), nil
+	}
+
+	if m.CredentialStore == "" {
+		return "", fmt.Errorf("no password stored for %s", m.Key())
+	}
+	store, err := NewCredentialStore(m.CredentialStore)
+	if err != nil {
+		return "", err
+	}
+	password, err := store.Get(m.ConfigDir)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode password: %v", err)
+		return "", fmt.Errorf("failed to read password from %s credential store: %v", m.CredentialStore, err)
 	}
-	return string(decodedBytes), nil
+	m.password = password
+	return password, nil
 }
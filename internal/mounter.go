@@ -17,6 +17,37 @@ type Mounter interface {
 	Unmount() error
 }
 
+// MounterDefinition declares a mounter, providers refer to it by name
+type MounterDefinition struct {
+	// Name is the name of the mounter, it is recorded as mount method
+	Name string
+
+	// Available returns an error if the mounter can't be used on this system
+	Available func() error
+
+	// New creates the mounter for a mount
+	New func(metadata *Metadata) Mounter
+
+	// Interactive reports if mounting may prompt on the terminal, e.g. for sudo. The daemon doesn't remount with it, optional
+	Interactive func() bool
+}
+
+// mounters are the registered mounters by name
+var mounters = map[string]*MounterDefinition{}
+
+// RegisterMounter adds a mounter, it is called from init of the mounter
+func RegisterMounter(definition MounterDefinition) {
+	if _, exists := mounters[definition.Name]; exists {
+		panic("mounter " + definition.Name + " is registered twice")
+	}
+	mounters[definition.Name] = &definition
+}
+
+// LookupMounter returns the definition of a mounter, nil if it doesn't exist
+func LookupMounter(name string) *MounterDefinition {
+	return mounters[name]
+}
+
 type BaseMounter struct {
 	Metadata *Metadata
 }
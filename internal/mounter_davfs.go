@@ -2,13 +2,32 @@ package internal
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"k8s.io/utils/mount"
 )
 
+// DavFSMounterName is the name of the davfs2 mounter
+const DavFSMounterName = "davfs2"
+
+func init() {
+	RegisterMounter(MounterDefinition{
+		Name: DavFSMounterName,
+		Available: func() error {
+			if _, err := exec.LookPath("mount.davfs"); err != nil {
+				return fmt.Errorf("mount.davfs is not installed")
+			}
+			return nil
+		},
+		New: func(metadata *Metadata) Mounter { return NewDavFSMounter(metadata) },
+	})
+}
+
 // DavFSMounter implements the Mounter interface using davfs2
 type DavFSMounter struct {
 	BaseMounter
@@ -27,7 +46,7 @@ func NewDavFSMounter(metadata *Metadata) *DavFSMounter {
 
 // Name returns the name of the mounter
 func (m *DavFSMounter) Name() string {
-	return "davfs2"
+	return DavFSMounterName
 }
 
 // Mount mounts a WebDAV volume using davfs2
@@ -54,7 +73,11 @@ func (m *DavFSMounter) Mount() (pid int, err error) {
 	}
 
 	// Prepare the source URL
-	source := fmt.Sprintf("http://%s:%d/", host, port)
+	scheme := "http"
+	if m.Metadata.TLS {
+		scheme = "https"
+	}
+	source := fmt.Sprintf("%s://%s/", scheme, net.JoinHostPort(host, strconv.Itoa(port)))
 
 	// Prepare mount options
 	uid := os.Getuid()
@@ -63,6 +86,16 @@ func (m *DavFSMounter) Mount() (pid int, err error) {
 		fmt.Sprintf("uid=%d", uid),
 		fmt.Sprintf("gid=%d", gid),
 	}
+	if m.Metadata.ReadOnly {
+		options = append(options, "ro")
+	}
+	if m.Metadata.TLS {
+		configFile, configErr := m.writeConfig()
+		if configErr != nil {
+			return 0, configErr
+		}
+		options = append(options, "conf="+configFile)
+	}
 
 	// Use direct mount command with credentials in URL
 	mountArgs := []string{
@@ -116,3 +149,13 @@ func (m *DavFSMounter) Unmount() error {
 
 	return nil
 }
+
+// writeConfig writes a davfs2 configuration file that trusts the CA generated for the mount
+func (m *DavFSMounter) writeConfig() (string, error) {
+	configFile := filepath.Join(m.Metadata.ConfigDir, "davfs2.conf")
+	content := fmt.Sprintf("trust_ca_cert %s\n", m.Metadata.GetCACertFilePath())
+	if err := os.WriteFile(configFile, []byte(content), 0600); err != nil {
+		return "", fmt.Errorf("failed to write davfs2 config: %v", err)
+	}
+	return configFile, nil
+}
@@ -9,6 +9,24 @@ import (
 	"k8s.io/utils/mount"
 )
 
+// NFSMounterName is the name of the kernel NFS client mounter
+const NFSMounterName = "nfs"
+
+func init() {
+	RegisterMounter(MounterDefinition{
+		Name: NFSMounterName,
+		Available: func() error {
+			if !IsMacOs() && !HasSysAdminCapability() {
+				return fmt.Errorf("mounting with the kernel NFS client requires root privileges")
+			}
+			return nil
+		},
+		New: func(metadata *Metadata) Mounter { return NewNFSMounter(metadata) },
+		// sudo asks for the password on macOS
+		Interactive: IsMacOs,
+	})
+}
+
 // NFSMounter implements the Mounter interface using NFS
 type NFSMounter struct {
 	BaseMounter
@@ -27,7 +45,7 @@ func NewNFSMounter(metadata *Metadata) *NFSMounter {
 
 // Name returns the name of the mounter
 func (m *NFSMounter) Name() string {
-	return "nfs"
+	return NFSMounterName
 }
 
 // Mount mounts an NFS volume
@@ -63,6 +81,9 @@ func (m *NFSMounter) Mount() (pid int, err error) {
 			fmt.Sprintf("port=%d", port),
 			fmt.Sprintf("mountport=%d", port),
 		}
+		if m.Metadata.ReadOnly {
+			options = append(options, "ro")
+		}
 
 		// Execute mount command with sudo
 		cmd := exec.Command("sudo", "mount", "-t", "nfs", "-o", strings.Join(options, ","), macSource, mountDir)
@@ -87,6 +108,9 @@ func (m *NFSMounter) Mount() (pid int, err error) {
 			fmt.Sprintf("port=%d", port),
 			fmt.Sprintf("mountport=%d", port),
 		}
+		if m.Metadata.ReadOnly {
+			options = append(options, "ro")
+		}
 
 		// On Linux, use kubernetes mount utils
 		if err = m.mounter.Mount(source, mountDir, "nfs", options); err != nil {
@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+func init() {
+	RegisterMounter(MounterDefinition{
+		Name: NFSFuseCommandName,
+		Available: func() error {
+			if IsMacOs() {
+				return fmt.Errorf("the userspace NFS client is not supported on macOS")
+			}
+			_, err := findFusermount()
+			return err
+		},
+		New: func(metadata *Metadata) Mounter { return NewNFSFuseMounter(metadata) },
+	})
+}
+
+// NFSFuseMounter implements the Mounter interface with the built-in userspace NFS client served through FUSE.
+// It doesn't need root privileges, only fusermount.
+type NFSFuseMounter struct {
+	BaseMounter
+}
+
+// NewNFSFuseMounter creates a new NFSFuseMounter
+func NewNFSFuseMounter(metadata *Metadata) *NFSFuseMounter {
+	return &NFSFuseMounter{
+		BaseMounter: BaseMounter{
+			Metadata: metadata,
+		},
+	}
+}
+
+// Name returns the name of the mounter
+func (m *NFSFuseMounter) Name() string {
+	return NFSFuseCommandName
+}
+
+// GetLogFilePath returns the path to the log file of the FUSE process
+func (m *NFSFuseMounter) GetLogFilePath() string {
+	return filepath.Join(m.Metadata.ConfigDir, "nfs-fuse.log")
+}
+
+// Mount starts the FUSE process in the background and waits until the mount directory is mounted
+func (m *NFSFuseMounter) Mount() (pid int, err error) {
+	mountDir := m.Metadata.GetMountDir()
+
+	if _, err = findFusermount(); err != nil {
+		return
+	}
+
+	// Create mount directory if it doesn't exist
+	if err = EnsureMountDirExists(mountDir); err != nil {
+		return
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return pid, fmt.Errorf("failed to determine executable: %v", err)
+	}
+
+	logPath := m.GetLogFilePath()
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return pid, fmt.Errorf("failed to create log file: %v", err)
+	}
+	defer func(logFile *os.File) {
+		err := logFile.Close()
+		if err != nil {
+			fmt.Printf("warning: failed to close log file %s: %v\n", logPath, err)
+		}
+	}(logFile)
+
+	cmd := exec.Command(executable, NFSFuseCommandName, "-config", m.Metadata.GetConfigFilePath())
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+
+	// Set the command to run in its own process group
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid: true,
+	}
+
+	if err := cmd.Start(); err != nil {
+		return pid, fmt.Errorf("failed to start NFS FUSE process: %v", err)
+	}
+	pid = cmd.Process.Pid
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	deadline := time.After(15 * time.Second)
+	for {
+		select {
+		case err := <-exited:
+			logs, _ := os.ReadFile(logPath)
+			return 0, fmt.Errorf("NFS FUSE process exited: %v\nOutput: %s", err, string(logs))
+		case <-deadline:
+			_ = cmd.Process.Kill()
+			return 0, fmt.Errorf("expected %s to be a mount point but it is not", mountDir)
+		case <-time.After(200 * time.Millisecond):
+			if IsMountPoint(mountDir) {
+				// the FUSE process keeps running after this program exits
+				return pid, nil
+			}
+		}
+	}
+}
+
+// Unmount unmounts the FUSE mount, which ends the FUSE process
+func (m *NFSFuseMounter) Unmount() error {
+	mountDir := m.Metadata.GetMountDir()
+
+	if IsMountPoint(mountDir) {
+		fusermount, err := findFusermount()
+		if err != nil {
+			return err
+		}
+		output, err := exec.Command(fusermount, "-u", mountDir).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to unmount %s: %v\nOutput: %s", mountDir, err, string(output))
+		}
+	}
+
+	// the process exits on unmount, make sure it doesn't linger if the mount was already gone
+	if IsProcessAlive(m.Metadata.MountPid) {
+		if err := syscall.Kill(m.Metadata.MountPid, syscall.SIGTERM); err != nil {
+			fmt.Printf("Warning: Failed to stop NFS FUSE process: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+// findFusermount returns the fusermount binary that allows unprivileged users to mount FUSE filesystems
+func findFusermount() (string, error) {
+	for _, name := range []string{"fusermount3", "fusermount"} {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("fusermount is not installed, install fuse3 to mount NFS without root privileges")
+}
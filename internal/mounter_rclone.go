@@ -11,6 +11,22 @@ import (
 	"time"
 )
 
+// RcloneMounterName is the name of the rclone mounter
+const RcloneMounterName = "rclone"
+
+func init() {
+	RegisterMounter(MounterDefinition{
+		Name: RcloneMounterName,
+		Available: func() error {
+			if _, err := exec.LookPath("rclone"); err != nil {
+				return fmt.Errorf("rclone is not installed, see https://rclone.org/install/")
+			}
+			return nil
+		},
+		New: func(metadata *Metadata) Mounter { return NewRcloneMounter(metadata) },
+	})
+}
+
 // RcloneMounter implements the Mounter interface using rclone
 type RcloneMounter struct {
 	BaseMounter
@@ -27,7 +43,7 @@ func NewRcloneMounter(metadata *Metadata) *RcloneMounter {
 
 // Name returns the name of the mounter
 func (m *RcloneMounter) Name() string {
-	return "rclone"
+	return RcloneMounterName
 }
 
 // Mount mounts a volume using rclone
@@ -57,14 +73,28 @@ func (m *RcloneMounter) Mount() (pid int, err error) {
 		return
 	}
 
-	// Determine remote name based on provider type
+	// The remote is named after the provider type, some servers serve the volume in a subdirectory
 	remoteName := providerType + ":/"
+	if definition := LookupProvider(providerType); definition != nil {
+		if subDir := definition.GetMountSubDir(m.Metadata); subDir != "" {
+			remoteName = providerType + ":" + subDir
+		}
+	}
 
-	// Execute the command directly without bash
-	cmd := exec.Command("rclone", "mount", remoteName, mountDir,
+	args := []string{"mount", remoteName, mountDir,
 		"--config", configFile,
 		"--vfs-cache-mode", "writes",
-		"--log-file", logFile)
+		"--log-file", logFile}
+	if m.Metadata.ReadOnly {
+		args = append(args, "--read-only")
+	}
+	if m.Metadata.TLS {
+		// also set in the config file, the flag covers rclone versions without config overrides
+		args = append(args, "--ca-cert", m.Metadata.GetCACertFilePath())
+	}
+
+	// Execute the command directly without bash
+	cmd := exec.Command("rclone", args...)
 
 	// Set the command to run in its own process group
 	cmd.SysProcAttr = &syscall.SysProcAttr{
@@ -79,11 +109,11 @@ func (m *RcloneMounter) Mount() (pid int, err error) {
 	pid = cmd.Process.Pid
 	fmt.Printf("DEBUG: Rclone process started with pid: %d\n", pid)
 
-	// Release the process so it continues running after this program exits
-	if err = cmd.Process.Release(); err != nil {
-		err = fmt.Errorf("failed to release rclone process: %v", err)
-		return
-	}
+	// The process continues running after this program exits. A long running parent like the mount daemon
+	// has to reap it, otherwise a crashed rclone stays a zombie that still counts as alive.
+	go func() {
+		_ = cmd.Wait()
+	}()
 
 	// Give it a moment to start up
 	time.Sleep(2 * time.Second)
@@ -106,50 +136,35 @@ func (m *RcloneMounter) Unmount() error {
 	return nil
 }
 
+// GetConfig returns the rclone config of the remote, the section is declared by the provider
 func (m *RcloneMounter) GetConfig() (content string, err error) {
-	host := m.Metadata.LocalHostname
-	port := m.Metadata.LocalPort
-	username := m.Metadata.MountUsername
-	password, err := m.Metadata.GetDecodedPassword()
-	if err != nil {
-		err = fmt.Errorf("failed to decode password: %v", err)
+	providerType := m.Metadata.ProviderType
+	definition := LookupProvider(providerType)
+	if definition == nil || definition.RcloneConfig == nil {
+		err = fmt.Errorf("unsupported provider type for rclone: %s", providerType)
 		return
 	}
-	providerType := m.Metadata.ProviderType
 
-	// Obscure the password using rclone
+	return definition.RcloneConfig(m.Metadata)
+}
+
+// obscurePassword obscures a password for the rclone config using rclone
+func obscurePassword(password string) (string, error) {
 	obscuredCmd := exec.Command("rclone", "obscure", password)
 	obscuredOutput, err := obscuredCmd.CombinedOutput()
 	if err != nil {
-		err = fmt.Errorf("failed to obscure password: %v", err)
-		return
-	}
-	obscuredPassword := strings.TrimSpace(string(obscuredOutput))
-
-	switch providerType {
-	case "webdav":
-		content = fmt.Sprintf(`[webdav]
-type = webdav
-url = http://%s:%d
-vendor = other
-user = %s
-pass = %s
-`, host, port, username, obscuredPassword)
-	case "sftp":
-		content = fmt.Sprintf(`[sftp]
-type = sftp
-hostname = %s
-port = %d
-vendor = other
-user = %s
-pass = %s
-`, host, port, username, obscuredPassword)
-	default:
-		err = fmt.Errorf("unsupported provider type for rclone: %s", providerType)
-		return
+		return "", fmt.Errorf("failed to obscure password: %v", err)
 	}
+	return strings.TrimSpace(string(obscuredOutput)), nil
+}
 
-	return
+// getObscuredPassword returns the password of a mount obscured for the rclone config
+func getObscuredPassword(metadata *Metadata) (string, error) {
+	password, err := metadata.GetDecodedPassword()
+	if err != nil {
+		return "", fmt.Errorf("failed to decode password: %v", err)
+	}
+	return obscurePassword(password)
 }
 
 func (m *RcloneMounter) GetRcloneConfigFilePath() string {
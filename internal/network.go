@@ -1,15 +1,15 @@
 package internal
 
 import (
-	"fmt"
 	"net"
+	"strconv"
 	"time"
 )
 
 // CheckHostPort checks if a host:port combination is reachable
 // It will retry until the connection succeeds or timeout is reached
 func CheckHostPort(host string, port int, msRetryTimeout int) bool {
-	address := fmt.Sprintf("%s:%d", host, port)
+	address := net.JoinHostPort(host, strconv.Itoa(port))
 	deadline := time.Now().Add(time.Duration(msRetryTimeout) * time.Millisecond)
 
 	for time.Now().Before(deadline) {
@@ -0,0 +1,585 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/willscott/go-nfs-client/nfs"
+	"github.com/willscott/go-nfs-client/nfs/rpc"
+)
+
+// NFSFuseCommandName is the hidden command that serves an NFS export through FUSE, it is started by the nfs-fuse mounter
+const NFSFuseCommandName = "nfs-fuse"
+
+// nfsAttrTimeout is how long the kernel caches attributes and entries of the FUSE mount
+const nfsAttrTimeout = time.Second
+
+// RunNFSFuse connects to the NFS server of a mount with a userspace NFSv3 client and serves it on the mount
+// directory through FUSE until the directory is unmounted or the process is terminated
+func RunNFSFuse(meta *Metadata) error {
+	mountDir := meta.GetMountDir()
+
+	hostname, _ := os.Hostname()
+	nfsFS := &nfsFS{
+		host:     meta.LocalHostname,
+		port:     meta.LocalPort,
+		auth:     rpc.NewAuthUnix(hostname, uint32(os.Getuid()), uint32(os.Getgid())).Auth(),
+		readOnly: meta.ReadOnly,
+	}
+	if err := nfsFS.connect(); err != nil {
+		return err
+	}
+	defer nfsFS.close()
+
+	timeout := nfsAttrTimeout
+	options := &fs.Options{
+		MountOptions: fuse.MountOptions{
+			FsName: fmt.Sprintf("%s:%d", meta.LocalHostname, meta.LocalPort),
+			Name:   NFSFuseCommandName,
+		},
+		AttrTimeout:  &timeout,
+		EntryTimeout: &timeout,
+	}
+	if meta.ReadOnly {
+		options.MountOptions.Options = append(options.MountOptions.Options, "ro")
+	}
+
+	root := &nfsNode{fs: nfsFS}
+	server, err := fs.Mount(mountDir, root, options)
+	if err != nil {
+		return fmt.Errorf("failed to mount %s with FUSE: %v", mountDir, err)
+	}
+	fmt.Printf("Serving %s:%d on %s\n", meta.LocalHostname, meta.LocalPort, mountDir)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		fmt.Printf("Received %s, unmounting %s\n", sig, mountDir)
+		if err := server.Unmount(); err != nil {
+			fmt.Printf("Error unmounting %s: %v\n", mountDir, err)
+		}
+	}()
+
+	server.Wait()
+	return nil
+}
+
+// nfsFS is shared by all nodes of a FUSE mount backed by an NFS export.
+// The export is mounted again over a new connection if the connection broke or its file handles became stale,
+// e.g. after port forwarding switched to a rescheduled server pod.
+type nfsFS struct {
+	host     string
+	port     int
+	auth     rpc.Auth
+	readOnly bool
+
+	mu          sync.Mutex
+	client      *rpc.Client
+	target      *nfs.Target
+	reconnectMu sync.Mutex
+}
+
+// connect dials the NFS server and mounts the export, a former connection is closed
+func (f *nfsFS) connect() error {
+	// rclone serves the MOUNT and NFS programs on the same port, no portmapper is needed
+	client, err := nfs.DialServiceAtPort(f.host, f.port)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NFS server: %v", err)
+	}
+	mount := &nfs.Mount{Client: client}
+	target, err := mount.Mount("/", f.auth)
+	if err != nil {
+		client.Close()
+		return fmt.Errorf("failed to mount NFS export: %v", err)
+	}
+
+	f.mu.Lock()
+	former := f.client
+	f.client, f.target = client, target
+	f.mu.Unlock()
+	if former != nil {
+		former.Close()
+	}
+	return nil
+}
+
+// close closes the connection to the NFS server
+func (f *nfsFS) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.client != nil {
+		f.client.Close()
+	}
+}
+
+// current returns the target of the current connection
+func (f *nfsFS) current() *nfs.Target {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.target
+}
+
+// reconnect mounts the export over a new connection, unless another operation already replaced the failed target
+func (f *nfsFS) reconnect(failed *nfs.Target) error {
+	f.reconnectMu.Lock()
+	defer f.reconnectMu.Unlock()
+	if f.current() != failed {
+		return nil
+	}
+
+	fmt.Printf("Reconnecting to %s:%d\n", f.host, f.port)
+	if err := f.connect(); err != nil {
+		fmt.Printf("Error reconnecting: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// do runs an operation on the export, it is run once more after reconnecting if the connection was lost
+func (f *nfsFS) do(op func(target *nfs.Target) error) error {
+	target := f.current()
+	err := op(target)
+	if !needsReconnect(err) {
+		return err
+	}
+	if err := f.reconnect(target); err != nil {
+		return err
+	}
+	return op(f.current())
+}
+
+// needsReconnect checks if an error of the NFS client is caused by a broken connection or by file handles of a former server
+func needsReconnect(err error) bool {
+	if err == nil {
+		return false
+	}
+	var nfsErr *nfs.Error
+	if errors.As(err, &nfsErr) {
+		return nfsErr.ErrorNum == nfs.NFS3ErrStale || nfsErr.ErrorNum == nfs.NFS3ErrBadHandle
+	}
+	return toErrno(err) == syscall.EIO
+}
+
+// nfsNode is a file, directory or symlink of the NFS export, addressed by its path relative to the export
+type nfsNode struct {
+	fs.Inode
+	fs *nfsFS
+}
+
+var (
+	_ fs.NodeLookuper   = (*nfsNode)(nil)
+	_ fs.NodeGetattrer  = (*nfsNode)(nil)
+	_ fs.NodeSetattrer  = (*nfsNode)(nil)
+	_ fs.NodeReaddirer  = (*nfsNode)(nil)
+	_ fs.NodeOpener     = (*nfsNode)(nil)
+	_ fs.NodeCreater    = (*nfsNode)(nil)
+	_ fs.NodeMkdirer    = (*nfsNode)(nil)
+	_ fs.NodeUnlinker   = (*nfsNode)(nil)
+	_ fs.NodeRmdirer    = (*nfsNode)(nil)
+	_ fs.NodeRenamer    = (*nfsNode)(nil)
+	_ fs.NodeSymlinker  = (*nfsNode)(nil)
+	_ fs.NodeReadlinker = (*nfsNode)(nil)
+)
+
+// path returns the path of the node relative to the root of the export
+func (n *nfsNode) path() string {
+	return n.Path(nil)
+}
+
+// childPath returns the path of a child of the node relative to the root of the export
+func (n *nfsNode) childPath(name string) string {
+	return path.Join(n.path(), name)
+}
+
+// newChild creates the inode of a child from its NFS attributes
+func (n *nfsNode) newChild(ctx context.Context, attr *nfs.Fattr, out *fuse.EntryOut) *fs.Inode {
+	setFuseAttr(&out.Attr, attr)
+	child := &nfsNode{fs: n.fs}
+	return n.NewInode(ctx, child, fs.StableAttr{Mode: out.Attr.Mode & syscall.S_IFMT, Ino: attr.Fileid})
+}
+
+// lookupChild fetches the attributes of a child after it was created
+func (n *nfsNode) lookupChild(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	var attr *nfs.Fattr
+	err := n.fs.do(func(target *nfs.Target) (err error) {
+		attr, err = target.Getattr(n.childPath(name))
+		return err
+	})
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return n.newChild(ctx, attr, out), 0
+}
+
+func (n *nfsNode) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	return n.lookupChild(ctx, name, out)
+}
+
+func (n *nfsNode) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	var attr *nfs.Fattr
+	err := n.fs.do(func(target *nfs.Target) (err error) {
+		attr, err = target.Getattr(n.path())
+		return err
+	})
+	if err != nil {
+		return toErrno(err)
+	}
+	setFuseAttr(&out.Attr, attr)
+	return 0
+}
+
+func (n *nfsNode) Setattr(ctx context.Context, f fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	if n.fs.readOnly {
+		return syscall.EROFS
+	}
+
+	sattr := nfs.Sattr3{}
+	if mode, ok := in.GetMode(); ok {
+		sattr.Mode = nfs.SetMode{SetIt: true, Mode: mode & 07777}
+	}
+	if size, ok := in.GetSize(); ok {
+		sattr.Size = nfs.SetSize{SetIt: true, Size: size}
+	}
+	if atime, ok := in.GetATime(); ok {
+		sattr.Atime = nfs.SetTime{SetIt: nfs.SetToClientTime, Time: toNFSTime(atime)}
+	}
+	if mtime, ok := in.GetMTime(); ok {
+		sattr.Mtime = nfs.SetTime{SetIt: nfs.SetToClientTime, Time: toNFSTime(mtime)}
+	}
+	// ownership can't be changed, the server maps all files to its own user
+
+	err := n.fs.do(func(target *nfs.Target) error {
+		return target.Setattr(n.path(), sattr)
+	})
+	if err != nil {
+		return toErrno(err)
+	}
+	return n.Getattr(ctx, f, out)
+}
+
+func (n *nfsNode) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	var entries []*nfs.EntryPlus
+	err := n.fs.do(func(target *nfs.Target) (err error) {
+		entries, err = target.ReadDirPlus(n.path())
+		return err
+	})
+	if err != nil {
+		return nil, toErrno(err)
+	}
+
+	dirEntries := make([]fuse.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		dirEntry := fuse.DirEntry{Name: entry.FileName, Ino: entry.FileId}
+		if entry.Attr.IsSet {
+			dirEntry.Mode = fileTypeMode(entry.Attr.Attr.Type)
+		}
+		dirEntries = append(dirEntries, dirEntry)
+	}
+	return fs.NewListDirStream(dirEntries), 0
+}
+
+func (n *nfsNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	writable := flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0
+	if writable && n.fs.readOnly {
+		return nil, 0, syscall.EROFS
+	}
+
+	file, err := n.fs.open(n.path())
+	if err != nil {
+		return nil, 0, toErrno(err)
+	}
+	if flags&syscall.O_TRUNC != 0 && writable {
+		err := n.fs.do(func(target *nfs.Target) error {
+			return target.Setattr(n.path(), nfs.Sattr3{Size: nfs.SetSize{SetIt: true, Size: 0}})
+		})
+		if err != nil {
+			return nil, 0, toErrno(err)
+		}
+	}
+	return &nfsFile{fs: n.fs, path: n.path(), file: file, writable: writable}, 0, 0
+}
+
+func (n *nfsNode) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	if n.fs.readOnly {
+		return nil, nil, 0, syscall.EROFS
+	}
+
+	childPath := n.childPath(name)
+	err := n.fs.do(func(target *nfs.Target) error {
+		_, err := target.Create(childPath, os.FileMode(mode&07777))
+		return err
+	})
+	if err != nil {
+		return nil, nil, 0, toErrno(err)
+	}
+	file, err := n.fs.open(childPath)
+	if err != nil {
+		return nil, nil, 0, toErrno(err)
+	}
+	child, errno := n.lookupChild(ctx, name, out)
+	if errno != 0 {
+		return nil, nil, 0, errno
+	}
+	return child, &nfsFile{fs: n.fs, path: childPath, file: file, writable: true}, 0, 0
+}
+
+func (n *nfsNode) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	if n.fs.readOnly {
+		return nil, syscall.EROFS
+	}
+	err := n.fs.do(func(target *nfs.Target) error {
+		_, err := target.Mkdir(n.childPath(name), os.FileMode(mode&07777))
+		return err
+	})
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return n.lookupChild(ctx, name, out)
+}
+
+func (n *nfsNode) Unlink(ctx context.Context, name string) syscall.Errno {
+	if n.fs.readOnly {
+		return syscall.EROFS
+	}
+	return toErrno(n.fs.do(func(target *nfs.Target) error {
+		return target.Remove(n.childPath(name))
+	}))
+}
+
+func (n *nfsNode) Rmdir(ctx context.Context, name string) syscall.Errno {
+	if n.fs.readOnly {
+		return syscall.EROFS
+	}
+	return toErrno(n.fs.do(func(target *nfs.Target) error {
+		return target.RmDir(n.childPath(name))
+	}))
+}
+
+func (n *nfsNode) Rename(ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	if n.fs.readOnly {
+		return syscall.EROFS
+	}
+	// RENAME_EXCHANGE and RENAME_NOREPLACE have no NFSv3 equivalent
+	if flags != 0 {
+		return syscall.ENOTSUP
+	}
+	newPath := path.Join(newParent.EmbeddedInode().Path(nil), newName)
+	return toErrno(n.fs.do(func(target *nfs.Target) error {
+		return target.Rename(n.childPath(name), newPath)
+	}))
+}
+
+func (n *nfsNode) Symlink(ctx context.Context, target, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	if n.fs.readOnly {
+		return nil, syscall.EROFS
+	}
+	err := n.fs.do(func(nfsTarget *nfs.Target) error {
+		return nfsTarget.Symlink(target, n.childPath(name))
+	})
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return n.lookupChild(ctx, name, out)
+}
+
+func (n *nfsNode) Readlink(ctx context.Context) ([]byte, syscall.Errno) {
+	var target string
+	err := n.fs.do(func(nfsTarget *nfs.Target) error {
+		file, err := nfsTarget.Open(n.path())
+		if err != nil {
+			return err
+		}
+		target, err = file.Readlink()
+		return err
+	})
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return []byte(target), 0
+}
+
+// open opens a file of the export
+func (f *nfsFS) open(path string) (*nfs.File, error) {
+	var file *nfs.File
+	err := f.do(func(target *nfs.Target) (err error) {
+		file, err = target.Open(path)
+		return err
+	})
+	return file, err
+}
+
+// nfsFile is an open file of the NFS export
+type nfsFile struct {
+	fs       *nfsFS
+	path     string
+	mu       sync.Mutex
+	file     *nfs.File
+	writable bool
+}
+
+// do runs an operation on the file, it is opened again by its path and the operation is repeated if the connection was lost.
+// The caller holds the lock.
+func (f *nfsFile) do(op func(file *nfs.File) error) error {
+	err := op(f.file)
+	if !needsReconnect(err) {
+		return err
+	}
+	file, err := f.fs.open(f.path)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	return op(file)
+}
+
+var (
+	_ fs.FileReader  = (*nfsFile)(nil)
+	_ fs.FileWriter  = (*nfsFile)(nil)
+	_ fs.FileFlusher = (*nfsFile)(nil)
+	_ fs.FileFsyncer = (*nfsFile)(nil)
+)
+
+func (f *nfsFile) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var n int
+	err := f.do(func(file *nfs.File) (err error) {
+		n, err = file.ReadAt(dest, off)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return fuse.ReadResultData(dest[:n]), 0
+}
+
+func (f *nfsFile) Write(ctx context.Context, data []byte, off int64) (uint32, syscall.Errno) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var n int
+	err := f.do(func(file *nfs.File) (err error) {
+		// the NFS client writes at its current position
+		if _, err := file.Seek(off, io.SeekStart); err != nil {
+			return err
+		}
+		n, err = file.Write(data)
+		return err
+	})
+	if err != nil {
+		return uint32(n), toErrno(err)
+	}
+	return uint32(n), 0
+}
+
+func (f *nfsFile) Flush(ctx context.Context) syscall.Errno {
+	return f.commit()
+}
+
+func (f *nfsFile) Fsync(ctx context.Context, flags uint32) syscall.Errno {
+	return f.commit()
+}
+
+// commit asks the server to persist written data, closing an NFS file only sends a COMMIT
+func (f *nfsFile) commit() syscall.Errno {
+	if !f.writable {
+		return 0
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return toErrno(f.do(func(file *nfs.File) error {
+		return file.Close()
+	}))
+}
+
+// setFuseAttr converts NFS attributes to FUSE attributes
+func setFuseAttr(out *fuse.Attr, attr *nfs.Fattr) {
+	out.Ino = attr.Fileid
+	out.Mode = fileTypeMode(attr.Type) | attr.FileMode&07777
+	out.Nlink = attr.Nlink
+	out.Uid = attr.UID
+	out.Gid = attr.GID
+	out.Size = attr.Filesize
+	out.Blocks = (attr.Used + 511) / 512
+	out.Blksize = 4096
+	out.Atime, out.Atimensec = uint64(attr.Atime.Seconds), attr.Atime.Nseconds
+	out.Mtime, out.Mtimensec = uint64(attr.Mtime.Seconds), attr.Mtime.Nseconds
+	out.Ctime, out.Ctimensec = uint64(attr.Ctime.Seconds), attr.Ctime.Nseconds
+}
+
+// fileTypeMode converts an NFSv3 file type (ftype3) to the file type bits of a mode
+func fileTypeMode(fileType uint32) uint32 {
+	switch fileType {
+	case 2:
+		return syscall.S_IFDIR
+	case 3:
+		return syscall.S_IFBLK
+	case 4:
+		return syscall.S_IFCHR
+	case 5:
+		return syscall.S_IFLNK
+	case 6:
+		return syscall.S_IFSOCK
+	case 7:
+		return syscall.S_IFIFO
+	default:
+		return syscall.S_IFREG
+	}
+}
+
+// toNFSTime converts a time to an NFSv3 timestamp
+func toNFSTime(t time.Time) nfs.NFS3Time {
+	return nfs.NFS3Time{Seconds: uint32(t.Unix()), Nseconds: uint32(t.Nanosecond())}
+}
+
+// toErrno converts an error of the NFS client to an errno returned to the kernel
+func toErrno(err error) syscall.Errno {
+	if err == nil {
+		return 0
+	}
+
+	var nfsErr *nfs.Error
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return syscall.ENOENT
+	case errors.Is(err, os.ErrExist):
+		return syscall.EEXIST
+	case errors.Is(err, os.ErrPermission):
+		return syscall.EPERM
+	case errors.Is(err, os.ErrInvalid):
+		return syscall.EINVAL
+	case errors.As(err, &nfsErr):
+		// NFSv3 reuses the errno values for the common errors
+		switch nfsErr.ErrorNum {
+		case nfs.NFS3ErrNameTooLong:
+			return syscall.ENAMETOOLONG
+		case nfs.NFS3ErrNotEmpty:
+			return syscall.ENOTEMPTY
+		case nfs.NFS3ErrDQuot:
+			return syscall.EDQUOT
+		case nfs.NFS3ErrStale, nfs.NFS3ErrBadHandle:
+			return syscall.ESTALE
+		case nfs.NFS3ErrNotSupp:
+			return syscall.ENOTSUP
+		case nfs.NFS3ErrIO, nfs.NFS3ErrNXIO, nfs.NFS3ErrAcces, nfs.NFS3ErrXDev, nfs.NFS3ErrNoDev, nfs.NFS3ErrNotDir,
+			nfs.NFS3ErrIsDir, nfs.NFS3ErrFBig, nfs.NFS3ErrNoSpc, nfs.NFS3ErrROFS, nfs.NFS3ErrMLink:
+			return syscall.Errno(nfsErr.ErrorNum)
+		}
+	}
+	return syscall.EIO
+}
@@ -1,16 +1,20 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"os"
 	"os/exec"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
 // IsPortListening checks if a port is listening on the specified host
 func IsPortListening(host string, port int) bool {
-	address := fmt.Sprintf("%s:%d", host, port)
+	address := net.JoinHostPort(host, strconv.Itoa(port))
 	conn, err := net.DialTimeout("tcp", address, 1*time.Second)
 	if err != nil {
 		return false
@@ -29,6 +33,22 @@ func FindFreePort(startPort, endPort int) (int, error) {
 	return 0, fmt.Errorf("no free port found in range %d-%d", startPort, endPort)
 }
 
+// FindFreePortRange finds count consecutive available ports in the specified range, reserved ports are skipped as well
+func FindFreePortRange(startPort, endPort, count int, reserved map[int]bool) ([]int, error) {
+	var ports []int
+	for port := startPort; port <= endPort && len(ports) < count; port++ {
+		if reserved[port] || IsPortListening("127.0.0.1", port) {
+			ports = nil
+			continue
+		}
+		ports = append(ports, port)
+	}
+	if len(ports) < count {
+		return nil, fmt.Errorf("no %d free consecutive ports found in range %d-%d", count, startPort, endPort)
+	}
+	return ports, nil
+}
+
 func IsMacOs() bool {
 	isMacOS := false
 	if _, err := exec.LookPath("sw_vers"); err == nil {
@@ -57,3 +77,172 @@ func IsMountPoint(path string) bool {
 		return err == nil
 	}
 }
+
+// IsProcessAlive checks if a process with the given pid exists
+func IsProcessAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// ForceUnmount detaches a mount point whose filesystem process is gone, e.g. a FUSE mount of a crashed rclone
+func ForceUnmount(path string) error {
+	var cmd *exec.Cmd
+	if IsMacOs() {
+		cmd = exec.Command("umount", "-f", path)
+	} else if _, err := exec.LookPath("fusermount"); err == nil {
+		cmd = exec.Command("fusermount", "-u", "-z", path)
+	} else {
+		cmd = exec.Command("umount", "-l", path)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to unmount %s: %v\nOutput: %s", path, err, string(output))
+	}
+	return nil
+}
+
+// capSysAdmin is the bit of CAP_SYS_ADMIN in the capability sets
+const capSysAdmin = 21
+
+// HasSysAdminCapability checks if the process may mount filesystems, i.e. has CAP_SYS_ADMIN on Linux.
+// The kernel NFS client requires it, without it NFS volumes are mounted through FUSE.
+func HasSysAdminCapability() bool {
+	status, err := os.ReadFile("/proc/self/status")
+	if err != nil {
+		// not Linux, other systems ask for privileges when mounting
+		return true
+	}
+
+	for _, line := range strings.Split(string(status), "\n") {
+		value, found := strings.CutPrefix(line, "CapEff:")
+		if !found {
+			continue
+		}
+		capabilities, err := strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		if err != nil {
+			return false
+		}
+		return capabilities&(1<<capSysAdmin) != 0
+	}
+	return false
+}
+
+// Process is a running process of the current user
+type Process struct {
+	Pid  int
+	Args []string
+}
+
+// ListProcesses returns the processes of the current user with their command line.
+// On Linux the arguments are read from /proc, on other systems they are split from the output of ps at spaces.
+func ListProcesses() ([]Process, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil || IsMacOs() {
+		return listProcessesPs()
+	}
+
+	uid := os.Getuid()
+	var processes []Process
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat("/proc/" + entry.Name())
+		if err != nil {
+			continue
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); !ok || int(stat.Uid) != uid {
+			continue
+		}
+		cmdline, err := os.ReadFile("/proc/" + entry.Name() + "/cmdline")
+		if err != nil || len(cmdline) == 0 {
+			continue
+		}
+		args := strings.Split(strings.TrimSuffix(string(cmdline), "\x00"), "\x00")
+		processes = append(processes, Process{Pid: pid, Args: args})
+	}
+	return processes, nil
+}
+
+// listProcessesPs returns the processes of the current user from ps
+func listProcessesPs() ([]Process, error) {
+	output, err := exec.Command("ps", "-U", strconv.Itoa(os.Getuid()), "-o", "pid=,args=").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %v", err)
+	}
+
+	var processes []Process
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		processes = append(processes, Process{Pid: pid, Args: fields[1:]})
+	}
+	return processes, nil
+}
+
+// ListMountPoints returns the mount points of the mount table
+func ListMountPoints() ([]string, error) {
+	if IsMacOs() {
+		// <device> on <mount point> (<type>, <options>)
+		output, err := exec.Command("mount").Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mount table: %v", err)
+		}
+		var mountPoints []string
+		for _, line := range strings.Split(string(output), "\n") {
+			_, rest, found := strings.Cut(line, " on ")
+			if !found {
+				continue
+			}
+			if index := strings.LastIndex(rest, " ("); index >= 0 {
+				rest = rest[:index]
+			}
+			mountPoints = append(mountPoints, rest)
+		}
+		return mountPoints, nil
+	}
+
+	data, err := os.ReadFile("/proc/self/mounts")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mount table: %v", err)
+	}
+	var mountPoints []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		mountPoints = append(mountPoints, unescapeMountPath(fields[1]))
+	}
+	return mountPoints, nil
+}
+
+// unescapeMountPath decodes the octal escapes of spaces, tabs, newlines and backslashes in /proc/self/mounts
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+	var result strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if value, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				result.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+		result.WriteByte(path[i])
+	}
+	return result.String()
+}
@@ -0,0 +1,177 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/yaml"
+)
+
+// DefaultImage is the image running the rclone server
+const DefaultImage = "rclone/rclone:latest"
+
+// PodOptions customize the pod running the server, they are read from the pod config file and flags
+type PodOptions struct {
+	Image            string                      `json:"image,omitempty"`
+	ImagePullSecrets []string                    `json:"imagePullSecrets,omitempty"`
+	Resources        corev1.ResourceRequirements `json:"resources,omitempty"`
+	Tolerations      []corev1.Toleration         `json:"tolerations,omitempty"`
+	NodeSelector     map[string]string           `json:"nodeSelector,omitempty"`
+	RunAsUser        *int64                      `json:"runAsUser,omitempty"`
+	RunAsGroup       *int64                      `json:"runAsGroup,omitempty"`
+	FSGroup          *int64                      `json:"fsGroup,omitempty"`
+}
+
+// LoadPodOptions reads pod options from a YAML or JSON file.
+// A missing file is only an error if required is set.
+func LoadPodOptions(path string, required bool) (PodOptions, error) {
+	var options PodOptions
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !required && errors.Is(err, fs.ErrNotExist) {
+			return options, nil
+		}
+		return options, fmt.Errorf("error reading pod config file: %v", err)
+	}
+
+	if err := yaml.UnmarshalStrict(data, &options); err != nil {
+		return options, fmt.Errorf("error parsing pod config file %s: %v", path, err)
+	}
+
+	return options, nil
+}
+
+// Merge applies the values set in override, lists are appended and maps are merged
+func (o *PodOptions) Merge(override PodOptions) {
+	if override.Image != "" {
+		o.Image = override.Image
+	}
+	o.ImagePullSecrets = append(o.ImagePullSecrets, override.ImagePullSecrets...)
+	o.Tolerations = append(o.Tolerations, override.Tolerations...)
+	if len(override.Resources.Requests) > 0 {
+		if o.Resources.Requests == nil {
+			o.Resources.Requests = corev1.ResourceList{}
+		}
+		maps.Copy(o.Resources.Requests, override.Resources.Requests)
+	}
+	if len(override.Resources.Limits) > 0 {
+		if o.Resources.Limits == nil {
+			o.Resources.Limits = corev1.ResourceList{}
+		}
+		maps.Copy(o.Resources.Limits, override.Resources.Limits)
+	}
+	if len(override.NodeSelector) > 0 {
+		if o.NodeSelector == nil {
+			o.NodeSelector = map[string]string{}
+		}
+		maps.Copy(o.NodeSelector, override.NodeSelector)
+	}
+	if override.RunAsUser != nil {
+		o.RunAsUser = override.RunAsUser
+	}
+	if override.RunAsGroup != nil {
+		o.RunAsGroup = override.RunAsGroup
+	}
+	if override.FSGroup != nil {
+		o.FSGroup = override.FSGroup
+	}
+}
+
+// GetImage returns the configured image or the default image
+func (o PodOptions) GetImage() string {
+	if o.Image != "" {
+		return o.Image
+	}
+	return DefaultImage
+}
+
+// GetImagePullSecrets returns the image pull secrets as references for the pod spec
+func (o PodOptions) GetImagePullSecrets() []corev1.LocalObjectReference {
+	var refs []corev1.LocalObjectReference
+	for _, name := range o.ImagePullSecrets {
+		refs = append(refs, corev1.LocalObjectReference{Name: name})
+	}
+	return refs
+}
+
+// PodSecurityContext returns the security context of the pod, nil if nothing is configured
+func (o PodOptions) PodSecurityContext() *corev1.PodSecurityContext {
+	if o.FSGroup == nil {
+		return nil
+	}
+	return &corev1.PodSecurityContext{FSGroup: o.FSGroup}
+}
+
+// ContainerSecurityContext returns the security context of the server container, nil if nothing is configured.
+// A server running as non-root user doesn't need any privileges, so it is locked down to satisfy the
+// "restricted" Pod Security Standard.
+func (o PodOptions) ContainerSecurityContext() *corev1.SecurityContext {
+	if o.RunAsUser == nil && o.RunAsGroup == nil {
+		return nil
+	}
+
+	securityContext := &corev1.SecurityContext{
+		RunAsUser:  o.RunAsUser,
+		RunAsGroup: o.RunAsGroup,
+	}
+	if o.RunAsUser != nil && *o.RunAsUser != 0 {
+		runAsNonRoot := true
+		allowPrivilegeEscalation := false
+		securityContext.RunAsNonRoot = &runAsNonRoot
+		securityContext.AllowPrivilegeEscalation = &allowPrivilegeEscalation
+		securityContext.Capabilities = &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}}
+		securityContext.SeccompProfile = &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}
+	}
+	return securityContext
+}
+
+// ParseToleration parses a toleration in the format key[=value][:effect]
+func ParseToleration(value string) (corev1.Toleration, error) {
+	toleration := corev1.Toleration{Operator: corev1.TolerationOpExists}
+
+	keyValue, effect, hasEffect := strings.Cut(value, ":")
+	if hasEffect {
+		switch corev1.TaintEffect(effect) {
+		case corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+			toleration.Effect = corev1.TaintEffect(effect)
+		default:
+			return toleration, fmt.Errorf("invalid toleration %s: unknown effect %s", value, effect)
+		}
+	}
+
+	key, val, hasValue := strings.Cut(keyValue, "=")
+	if key == "" {
+		return toleration, fmt.Errorf("invalid toleration %s: key must not be empty", value)
+	}
+	toleration.Key = key
+	if hasValue {
+		toleration.Operator = corev1.TolerationOpEqual
+		toleration.Value = val
+	}
+
+	return toleration, nil
+}
+
+// ParseResourceList parses resources in the format cpu=100m,memory=128Mi
+func ParseResourceList(value string) (corev1.ResourceList, error) {
+	resources := corev1.ResourceList{}
+	for _, item := range strings.Split(value, ",") {
+		name, quantity, ok := strings.Cut(item, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid resource %s, expected NAME=QUANTITY", item)
+		}
+		parsed, err := resource.ParseQuantity(quantity)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity for resource %s: %v", name, err)
+		}
+		resources[corev1.ResourceName(name)] = parsed
+	}
+	return resources, nil
+}
@@ -0,0 +1,368 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+// PortForwarder forwards connections accepted on local listeners to ports of a ready pod.
+// The stream connection to the pod is established on demand and re-established
+// with a freshly selected pod after it was closed, so the local ports stay stable.
+type PortForwarder struct {
+	client    *KubeClient
+	namespace string
+	selector  string
+	pod       string
+	ports     []*forwardedPort
+
+	// OnError is called for errors that occur while forwarding a connection
+	OnError func(err error)
+
+	mu          sync.Mutex
+	conn        httpstream.Connection
+	podName     string
+	requestID   int
+	connections int
+	lastActive  time.Time
+}
+
+// forwardedPort is a local port forwarded to a port of the pod
+type forwardedPort struct {
+	local    int
+	remote   int
+	listener net.Listener
+}
+
+// NewPortForwarder creates a port forwarder for pods matching the given label selector
+func NewPortForwarder(client *KubeClient, namespace string, selector string, localPort int, remotePort int) *PortForwarder {
+	return &PortForwarder{
+		client:    client,
+		namespace: namespace,
+		selector:  selector,
+		ports:     []*forwardedPort{{local: localPort, remote: remotePort}},
+		OnError: func(err error) {
+			fmt.Printf("Port forwarding error: %v\n", err)
+		},
+	}
+}
+
+// NewPodPortForwarder creates a port forwarder for a single pod, e.g. a pod with an injected ephemeral container
+func NewPodPortForwarder(client *KubeClient, namespace string, podName string, localPort int, remotePort int) *PortForwarder {
+	forwarder := NewPortForwarder(client, namespace, "", localPort, remotePort)
+	forwarder.pod = podName
+	return forwarder
+}
+
+// AddPort forwards an additional local port to a port of the pod, it has to be called before Listen
+func (f *PortForwarder) AddPort(localPort int, remotePort int) {
+	f.ports = append(f.ports, &forwardedPort{local: localPort, remote: remotePort})
+}
+
+// Listen binds the local ports on the given host
+func (f *PortForwarder) Listen(host string) error {
+	for _, port := range f.ports {
+		listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port.local)))
+		if err != nil {
+			_ = f.Close()
+			return fmt.Errorf("failed to listen on port %d: %v", port.local, err)
+		}
+		port.listener = listener
+	}
+
+	f.mu.Lock()
+	f.lastActive = time.Now()
+	f.mu.Unlock()
+	return nil
+}
+
+// PodName returns the name of the pod the current stream connection points to
+func (f *PortForwarder) PodName() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.podName
+}
+
+// Connect returns the stream connection to the pod, a new one is dialed if there is none
+func (f *PortForwarder) Connect() (httpstream.Connection, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.conn != nil {
+		if !isConnectionClosed(f.conn) {
+			return f.conn, nil
+		}
+		f.conn = nil
+	}
+
+	pod, err := f.findPod()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := f.client.DialPortForward(pod.Name, f.namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	f.conn = conn
+	f.podName = pod.Name
+	return conn, nil
+}
+
+// EnsureConnected verifies that the pod of the current stream connection is still ready.
+// If the connection was closed or the pod is gone, a new connection to a ready pod is established.
+func (f *PortForwarder) EnsureConnected() (reconnected bool, err error) {
+	f.mu.Lock()
+	conn, podName := f.conn, f.podName
+	f.mu.Unlock()
+
+	if conn != nil && !isConnectionClosed(conn) {
+		pod, err := f.client.GetPod(podName, f.namespace)
+		if err == nil && f.isUsable(pod) {
+			return false, nil
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			// the API server is not reachable, keep the current connection
+			return false, err
+		}
+
+		f.mu.Lock()
+		if f.conn == conn {
+			f.conn = nil
+		}
+		f.mu.Unlock()
+		_ = conn.Close()
+	}
+
+	if _, err := f.Connect(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// findPod returns the pod to forward to
+func (f *PortForwarder) findPod() (*corev1.Pod, error) {
+	if f.pod == "" {
+		return f.client.GetReadyPod(f.selector, f.namespace)
+	}
+
+	pod, err := f.client.GetPod(f.pod, f.namespace)
+	if err != nil {
+		return nil, err
+	}
+	if !f.isUsable(pod) {
+		return nil, fmt.Errorf("pod %s is not running", f.pod)
+	}
+	return pod, nil
+}
+
+// isUsable checks if a pod can serve forwarded connections.
+// A single pod only has to be running, its readiness reflects the application and not the injected server.
+func (f *PortForwarder) isUsable(pod *corev1.Pod) bool {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	return f.pod != "" || isPodReady(pod)
+}
+
+// isConnectionClosed checks if a stream connection was closed
+func isConnectionClosed(conn httpstream.Connection) bool {
+	select {
+	case <-conn.CloseChan():
+		return true
+	default:
+		return false
+	}
+}
+
+// Serve accepts local connections on all ports until the forwarder is closed.
+// If accepting fails on one port, the forwarder is closed and the error is returned.
+func (f *PortForwarder) Serve() error {
+	for _, port := range f.ports {
+		if port.listener == nil {
+			return fmt.Errorf("port forwarder is not listening")
+		}
+	}
+
+	results := make(chan error, len(f.ports))
+	for _, port := range f.ports {
+		go func() {
+			results <- f.servePort(port)
+		}()
+	}
+
+	var err error
+	for range f.ports {
+		if result := <-results; result != nil && err == nil {
+			err = result
+			_ = f.Close()
+		}
+	}
+	return err
+}
+
+// servePort accepts local connections on a single port until its listener is closed
+func (f *PortForwarder) servePort(port *forwardedPort) error {
+	for {
+		local, err := port.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("failed to accept connection on port %d: %v", port.local, err)
+		}
+
+		go func() {
+			f.trackConnection(1)
+			defer f.trackConnection(-1)
+			if err := f.handleConnection(local, port); err != nil {
+				f.OnError(err)
+			}
+		}()
+	}
+}
+
+// trackConnection counts the open local connections and records the time of the last change
+func (f *PortForwarder) trackConnection(delta int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.connections += delta
+	f.lastActive = time.Now()
+}
+
+// LastActive returns when a local connection was last accepted or closed, the current time while connections are open
+func (f *PortForwarder) LastActive() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.connections > 0 {
+		return time.Now()
+	}
+	return f.lastActive
+}
+
+// Close stops accepting connections and closes the stream connection to the pod
+func (f *PortForwarder) Close() error {
+	var errs []error
+	for _, port := range f.ports {
+		if port.listener != nil {
+			if err := port.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.conn != nil {
+		_ = f.conn.Close()
+		f.conn = nil
+	}
+
+	return errors.Join(errs...)
+}
+
+// nextRequestID returns a new id for the streams of a forwarded connection
+func (f *PortForwarder) nextRequestID() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := f.requestID
+	f.requestID++
+	return id
+}
+
+// handleConnection copies data between a local connection and a new data stream to the pod
+func (f *PortForwarder) handleConnection(local net.Conn, port *forwardedPort) error {
+	defer local.Close()
+
+	conn, err := f.Connect()
+	if err != nil {
+		return err
+	}
+
+	headers := http.Header{}
+	headers.Set(corev1.StreamType, corev1.StreamTypeError)
+	headers.Set(corev1.PortHeader, strconv.Itoa(port.remote))
+	headers.Set(corev1.PortForwardRequestIDHeader, strconv.Itoa(f.nextRequestID()))
+
+	errorStream, err := conn.CreateStream(headers)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("error creating error stream for port %d -> %d: %v", port.local, port.remote, err)
+	}
+	// we're not writing to this stream
+	_ = errorStream.Close()
+	defer conn.RemoveStreams(errorStream)
+
+	errorChan := make(chan error, 1)
+	go func() {
+		message, err := io.ReadAll(errorStream)
+		switch {
+		case err != nil:
+			errorChan <- fmt.Errorf("error reading from error stream for port %d -> %d: %v", port.local, port.remote, err)
+		case len(message) > 0:
+			errorChan <- fmt.Errorf("an error occurred forwarding %d -> %d: %s", port.local, port.remote, string(message))
+		}
+		close(errorChan)
+	}()
+
+	headers.Set(corev1.StreamType, corev1.StreamTypeData)
+	dataStream, err := conn.CreateStream(headers)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("error creating data stream for port %d -> %d: %v", port.local, port.remote, err)
+	}
+	defer conn.RemoveStreams(dataStream)
+
+	remoteDone := make(chan struct{})
+	localDone := make(chan struct{})
+
+	go func() {
+		// Copy from the remote side to the local connection
+		if _, err := io.Copy(local, dataStream); err != nil && !isClosedConnError(err) {
+			f.OnError(fmt.Errorf("error copying from remote stream to local connection: %v", err))
+		}
+		close(remoteDone)
+	}()
+
+	go func() {
+		// inform the server that we're not sending any more data
+		defer dataStream.Close()
+
+		// Copy from the local connection to the remote side
+		if _, err := io.Copy(dataStream, local); err != nil && !isClosedConnError(err) {
+			f.OnError(fmt.Errorf("error copying from local connection to remote stream: %v", err))
+			close(localDone)
+		}
+	}()
+
+	select {
+	case <-remoteDone:
+	case <-localDone:
+	}
+
+	// discard unsent data, otherwise reading the error stream may block
+	_ = dataStream.Reset()
+
+	if err := <-errorChan; err != nil {
+		// the stream connection is broken, the next local connection dials a new one
+		_ = conn.Close()
+		return err
+	}
+
+	return nil
+}
+
+// isClosedConnError checks if an error is caused by using a closed network connection
+func isClosedConnError(err error) bool {
+	return errors.Is(err, net.ErrClosed) || strings.Contains(strings.ToLower(err.Error()), "use of closed network connection")
+}
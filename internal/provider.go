@@ -1,9 +1,9 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 )
 
@@ -21,6 +21,15 @@ type VolumeProvider interface {
 	// Cleanup unmounts the volume and removes all resources
 	Cleanup() error
 
+	// Unmount unmounts the local mount and keeps the server, port forwarding is stopped if stopForwarding is set
+	Unmount(stopForwarding bool) error
+
+	// Remount restarts port forwarding if it isn't running and mounts the volume again if it was mounted before
+	Remount() error
+
+	// Reconnect restarts port forwarding if it isn't running without mounting the volume
+	Reconnect() error
+
 	// GetMetadata returns the metadata associated with the provider
 	GetMetadata() *Metadata
 
@@ -28,28 +37,37 @@ type VolumeProvider interface {
 	GetMounter() (Mounter, error)
 }
 
+// NewProviderFromMetadata creates the registered provider of the mount, nil if the provider type is unknown
 func NewProviderFromMetadata(metadata *Metadata) VolumeProvider {
-	switch metadata.ProviderType {
-	case "webdav":
-		return NewWebDAVProvider(metadata)
-	case "sftp":
-		return NewSFTPProvider(metadata)
-	case "nfs":
-		return NewNFSProvider(metadata)
-	default:
+	definition := LookupProvider(metadata.ProviderType)
+	if definition == nil {
 		return nil
 	}
+	return NewRcloneProvider(definition, metadata)
 }
 
 // BaseProvider implements common functionality for all providers
 type BaseProvider struct {
 	Metadata *Metadata
+	kube     *KubeClient
 }
 
 func (p *BaseProvider) GetMetadata() *Metadata {
 	return p.Metadata
 }
 
+// GetKubeClient returns the Kubernetes client, it is created on first use
+func (p *BaseProvider) GetKubeClient() (*KubeClient, error) {
+	if p.kube == nil {
+		client, err := NewKubeClient(p.Metadata.KubeOptions)
+		if err != nil {
+			return nil, err
+		}
+		p.kube = client
+	}
+	return p.kube, nil
+}
+
 // GetManifestPath returns the path to the manifest file
 func (p *BaseProvider) GetManifestPath() string {
 	return filepath.Join(p.Metadata.ConfigDir, "kustomize.yaml")
@@ -63,12 +81,18 @@ func (p *BaseProvider) GetLogFilePath() string {
 // cleanupMount unmounts a volume using the appropriate mounter
 func (p *BaseProvider) cleanupMount() {
 	mountDir := p.Metadata.GetMountDir()
-	if mountDir == "" {
+	if mountDir == "" || p.Metadata.MountMethod == "" {
+		// forwarded or unmounted, nothing is mounted
 		return
 	}
 
 	fmt.Printf("Unmounting %s...\n", mountDir)
 
+	// keep the daemon from remounting the volume
+	if err := DetachMount(p.Metadata); err != nil {
+		fmt.Printf("Warning: Error detaching mount from daemon: %v\n", err)
+	}
+
 	// we can't access the mounter directly, but we can re-init it to have access to the interface methods
 	chP := NewProviderFromMetadata(p.Metadata)
 	mounterImpl, err := chP.GetMounter()
@@ -83,33 +107,92 @@ func (p *BaseProvider) cleanupMount() {
 }
 
 func (p *BaseProvider) cleanupPortForwarding() {
-	pid := p.Metadata.PortForwardingPid
-	if pid != 0 {
-		fmt.Printf("Stopping port forwarding (PID: %d)...\n", pid)
-		err := exec.Command("bash", "-c", fmt.Sprintf("kill %d 2>/dev/null || true", pid)).Run()
-		if err != nil {
-			fmt.Printf("Warning: Failed to stop port forwarding: %v\n", err)
-		}
+	fmt.Printf("Stopping port forwarding...\n")
+	if err := StopPortForwarding(p.Metadata); err != nil {
+		fmt.Printf("Warning: Failed to stop port forwarding: %v\n", err)
 	}
 }
 
 func (p *BaseProvider) cleanupKubernetes() {
+	if p.Metadata.AttachPod != "" {
+		p.cleanupEphemeralContainer()
+		return
+	}
+
 	provisionerName := p.Metadata.ProvisionerName
 	manifestPath := p.GetManifestPath()
 
 	fmt.Printf("Deleting %s deployment %s...\n", p.Metadata.ProviderType, provisionerName)
+	// the manifest contains the service and network policy of the deployment as well
 	if _, err := os.Stat(manifestPath); err == nil {
-		err := DeleteManifest(manifestPath)
+		client, err := p.GetKubeClient()
+		if err != nil {
+			fmt.Printf("Warning: Error creating Kubernetes client: %v\n", err)
+			return
+		}
+
+		err = client.DeleteManifest(manifestPath)
 		if err != nil {
 			fmt.Printf("Warning: Error deleting manifest: %v\n", err)
 		}
 
+		// the secret isn't part of the manifest, it is deleted by name
+		if err := client.DeleteSecret(provisionerName, p.Metadata.Namespace); err != nil {
+			fmt.Printf("Warning: Error deleting credentials secret: %v\n", err)
+		}
+
+		if p.Metadata.HasLease() {
+			if err := client.DeleteLease(provisionerName, p.Metadata.Namespace); err != nil {
+				fmt.Printf("Warning: Error deleting lease: %v\n", err)
+			}
+		}
+
 		return
 	}
 
 	fmt.Printf("No manifest found for %s deployment %s\n", p.Metadata.ProviderType, provisionerName)
 }
 
+// cleanupEphemeralContainer stops the server injected into an existing pod.
+// Ephemeral containers can't be removed from a pod, stopping the process is all the API allows.
+func (p *BaseProvider) cleanupEphemeralContainer() {
+	podName := p.Metadata.AttachPod
+	containerName := p.Metadata.AttachContainer
+	if containerName == "" {
+		return
+	}
+
+	client, err := p.GetKubeClient()
+	if err != nil {
+		fmt.Printf("Warning: Error creating Kubernetes client: %v\n", err)
+		return
+	}
+
+	// The secret would only be removed with the pod
+	if err := client.DeleteSecret(p.Metadata.ProvisionerName, p.Metadata.Namespace); err != nil {
+		fmt.Printf("Warning: Error deleting credentials secret: %v\n", err)
+	}
+
+	pod, err := client.GetPod(podName, p.Metadata.Namespace)
+	if errors.Is(err, ErrNotFound) {
+		return
+	}
+	if err != nil {
+		fmt.Printf("Warning: Error getting pod %s: %v\n", podName, err)
+		return
+	}
+	if !IsEphemeralContainerRunning(pod, containerName) {
+		return
+	}
+
+	fmt.Printf("Stopping %s server in pod %s (the ephemeral container %s stays in the pod spec)...\n", p.Metadata.ProviderType, podName, containerName)
+	// never signal PID 1, with a shared process namespace it is the pause container of the pod
+	stop := []string{"sh", "-c", fmt.Sprintf(`kill "$(cat %s)"`, ephemeralPidFile)}
+	if output, err := client.ExecInContainer(podName, p.Metadata.Namespace, containerName, stop); err != nil {
+		fmt.Printf("Warning: Error stopping ephemeral container: %v %s\n", err, output)
+	}
+}
+
 // CleanupResources cleans up all resources associated with a provider
 func (p *BaseProvider) CleanupResources() error {
 
@@ -134,6 +217,8 @@ func (p *BaseProvider) CleanupResources() error {
 		err := os.Remove(mountDir)
 		if err != nil {
 			fmt.Printf("Warning: Failed to delete mount directory: %v\n", err)
+		} else {
+			removeEmptyParents(mountDir, MountBaseDir)
 		}
 	}
 
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"fmt"
+)
+
+func init() {
+	// Passive data connections use a small port range that is forwarded alongside the control port
+	RegisterProvider(ProviderDefinition{
+		Name:          "ftp",
+		RcloneCommand: "ftp",
+		RcloneArgs:    ftpRcloneArgs,
+		RemotePort:    2121,
+		Credentials:   passwordCredentials,
+		Mounters:      []string{RcloneMounterName},
+		RcloneConfig:  ftpRcloneConfig,
+		Prepare:       selectFTPPassivePorts,
+		Probe: func(metadata *Metadata) error {
+			return probeGreeting(metadata, "220")
+		},
+	})
+}
+
+// selectFTPPassivePorts selects the passive ports before the FTP server is deployed.
+// The server announces the local address in passive mode, so the passive ports have the same number locally and in the pod.
+// An attached server shares the network namespace of the pod, the ports declared by its containers are skipped.
+func selectFTPPassivePorts(metadata *Metadata) error {
+	var podPorts map[int]bool
+	if metadata.AttachPod != "" {
+		client, err := NewKubeClient(metadata.KubeOptions)
+		if err != nil {
+			return err
+		}
+		pod, err := client.GetPod(metadata.AttachPod, metadata.Namespace)
+		if err != nil {
+			return err
+		}
+		podPorts = GetPodPorts(pod)
+	}
+
+	ports, err := FindFreePortRange(PassivePortRangeStart, PassivePortRangeEnd, FTPPassivePorts, podPorts)
+	if err != nil {
+		return fmt.Errorf("error finding passive ports: %v", err)
+	}
+	metadata.ForwardedPorts = ports
+	return nil
+}
+
+// ftpRcloneArgs returns the passive mode arguments of the FTP server
+func ftpRcloneArgs(metadata *Metadata) []string {
+	ports := metadata.ForwardedPorts
+	return []string{
+		"--passive-port", fmt.Sprintf("%d-%d", ports[0], ports[len(ports)-1]),
+		"--public-ip", metadata.LocalHostname,
+	}
+}
+
+// ftpRcloneConfig returns the rclone remote of an FTP server
+func ftpRcloneConfig(metadata *Metadata) (string, error) {
+	obscuredPassword, err := getObscuredPassword(metadata)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(`[ftp]
+type = ftp
+host = %s
+port = %d
+user = %s
+pass = %s
+`, metadata.LocalHostname, metadata.LocalPort, metadata.MountUsername, obscuredPassword), nil
+}
@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func init() {
+	// The server lists directories and serves files to web browsers, it is read-only and can't be mounted
+	RegisterProvider(ProviderDefinition{
+		Name:           "http",
+		RcloneCommand:  "http",
+		SupportsTLS:    true,
+		AlwaysReadOnly: true,
+		Credentials:    passwordCredentials,
+		Probe: func(metadata *Metadata) error {
+			return probeHTTP(metadata, http.MethodGet, http.StatusOK)
+		},
+		Endpoint:      (*Metadata).GetURL,
+		PrintEndpoint: printHTTPEndpoint,
+	})
+}
+
+// printHTTPEndpoint prints the URL and credentials of an HTTP server for web browsers
+func printHTTPEndpoint(metadata *Metadata) error {
+	password, err := metadata.GetDecodedPassword()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("URL: %s\n", metadata.GetURL())
+	fmt.Printf("Username: %s\n", metadata.MountUsername)
+	fmt.Printf("Password: %s\n", password)
+	if metadata.TLS {
+		fmt.Println("The certificate of the server is signed by a CA generated for this mount, import it in the browser or confirm the warning.")
+	}
+	return nil
+}
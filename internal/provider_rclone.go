@@ -0,0 +1,196 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// RcloneProvider implements the VolumeProvider interface for the registered providers served by rclone
+type RcloneProvider struct {
+	RcloneBaseProvider
+	Definition *ProviderDefinition
+}
+
+// NewRcloneProvider creates a provider from its definition
+func NewRcloneProvider(definition *ProviderDefinition, metadata *Metadata) *RcloneProvider {
+	return &RcloneProvider{
+		RcloneBaseProvider: RcloneBaseProvider{
+			BaseProvider: BaseProvider{
+				Metadata: metadata,
+			},
+			RcloneCommand:   definition.RcloneCommand,
+			SupportsTLS:     definition.SupportsTLS,
+			SupportsKeyAuth: definition.SupportsKeyAuth,
+			AlwaysReadOnly:  definition.AlwaysReadOnly,
+			MountSubDir:     definition.GetMountSubDir(metadata),
+			Credentials:     definition.Credentials,
+		},
+		Definition: definition,
+	}
+}
+
+func (p *RcloneProvider) Name() string {
+	return p.Metadata.ProviderType
+}
+
+// Deploy prepares the provider and deploys the server
+func (p *RcloneProvider) Deploy() error {
+	if p.Definition.Prepare != nil {
+		if err := p.Definition.Prepare(p.Metadata); err != nil {
+			return err
+		}
+	}
+	if p.Definition.RcloneArgs != nil {
+		p.RcloneArgs = p.Definition.RcloneArgs(p.Metadata)
+	}
+
+	return p.RcloneBaseProvider.Deploy()
+}
+
+// GetMounter returns the first available mounter of the provider. An existing mount keeps the method it was mounted with.
+func (p *RcloneProvider) GetMounter() (Mounter, error) {
+	if !p.Definition.Mountable() {
+		return nil, fmt.Errorf("the %s provider can't be mounted, use forward to access the volume", p.Definition.Name)
+	}
+
+	if slices.Contains(p.Definition.Mounters, p.Metadata.MountMethod) {
+		if mounter := LookupMounter(p.Metadata.MountMethod); mounter != nil {
+			return mounter.New(p.Metadata), nil
+		}
+	}
+
+	var reasons []string
+	for _, name := range p.Definition.Mounters {
+		mounter := LookupMounter(name)
+		if mounter == nil {
+			continue
+		}
+		if err := mounter.Available(); err != nil {
+			reasons = append(reasons, err.Error())
+			continue
+		}
+		return mounter.New(p.Metadata), nil
+	}
+	return nil, fmt.Errorf("no %s mount method available: %s", p.Definition.Name, strings.Join(reasons, ", "))
+}
+
+// Mount mounts the volume to the mount directory
+func (p *RcloneProvider) Mount() error {
+	mounterImpl, err := p.GetMounter()
+	if err != nil {
+		return err
+	}
+	p.Metadata.MountMethod = mounterImpl.Name()
+
+	// Mount the volume
+	fmt.Printf("Using %s...\n", p.Metadata.MountMethod)
+	pid, err := mounterImpl.Mount()
+	if err != nil {
+		return err
+	}
+
+	p.Metadata.MountPid = pid
+	p.Metadata.Unmounted = false
+
+	// Save metadata
+	if err := p.Metadata.Save(); err != nil {
+		return fmt.Errorf("error saving metadata: %v", err)
+	}
+
+	return nil
+}
+
+// Cleanup unmounts the volume and removes all resources
+func (p *RcloneProvider) Cleanup() error {
+	return p.CleanupResources()
+}
+
+// Unmount unmounts the local mount with the recorded mounter. The server and metadata are kept, so Remount can reconnect.
+func (p *RcloneProvider) Unmount(stopForwarding bool) error {
+	mountDir := p.Metadata.GetMountDir()
+
+	if p.Metadata.MountMethod != "" {
+		// keep the daemon from remounting the volume
+		if err := DetachMount(p.Metadata); err != nil {
+			return fmt.Errorf("error detaching mount from daemon: %v", err)
+		}
+
+		mounterImpl, err := p.GetMounter()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Unmounting %s...\n", mountDir)
+		if err := mounterImpl.Unmount(); err != nil {
+			return fmt.Errorf("error unmounting volume: %v", err)
+		}
+
+		p.Metadata.MountMethod = ""
+		p.Metadata.MountPid = 0
+		// remount mounts the volume again, unlike a volume that was only forwarded
+		p.Metadata.Unmounted = true
+	} else {
+		fmt.Printf("Volume %s is not mounted\n", p.Metadata.PVCName)
+	}
+
+	if stopForwarding {
+		fmt.Printf("Stopping port forwarding...\n")
+		if err := StopPortForwarding(p.Metadata); err != nil {
+			return fmt.Errorf("error stopping port forwarding: %v", err)
+		}
+		p.Metadata.PortForwardingPid = 0
+	}
+
+	if err := p.Metadata.Save(); err != nil {
+		return fmt.Errorf("error saving metadata: %v", err)
+	}
+	return nil
+}
+
+// Remount restarts port forwarding if its daemon isn't running and mounts the volume again if it was mounted before
+func (p *RcloneProvider) Remount() error {
+	mountDir := p.Metadata.GetMountDir()
+	if p.Metadata.MountMethod != "" && IsMountPoint(mountDir) {
+		return fmt.Errorf("volume %s is already mounted at %s", p.Metadata.PVCName, mountDir)
+	}
+
+	if err := p.Reconnect(); err != nil {
+		return err
+	}
+
+	if !p.Definition.Mountable() || (p.Metadata.MountMethod == "" && !p.Metadata.Unmounted) {
+		// forwarding is all there is to restore, the volume was never mounted
+		return nil
+	}
+
+	if err := p.Mount(); err != nil {
+		return err
+	}
+
+	// the daemon stopped supervising the mount on unmount
+	if err := AttachMount(p.Metadata); err != nil {
+		fmt.Printf("Warning: Error attaching mount to daemon: %v\n", err)
+	}
+	return nil
+}
+
+// Reconnect restarts port forwarding if its daemon isn't running, the volume isn't mounted
+func (p *RcloneProvider) Reconnect() error {
+	_, err := GetDaemonStatus(p.Metadata)
+	if errors.Is(err, ErrNoDaemon) {
+		port := p.Metadata.LocalPort
+		fmt.Printf("Starting port forwarding on port %d...\n", port)
+		pid, err := StartPortForwarding(p.Metadata, p.GetLogFilePath())
+		if err != nil {
+			return fmt.Errorf("error starting port forwarding: %v", err)
+		}
+		p.Metadata.PortForwardingPid = pid
+		if err := p.Metadata.Save(); err != nil {
+			return fmt.Errorf("error saving metadata: %v", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("error querying port forwarding daemon: %v", err)
+	}
+	return nil
+}
@@ -3,9 +3,19 @@ package internal
 import (
 	"bytes"
 	_ "embed"
+	"errors"
 	"fmt"
 	"os"
+	"path"
+	"slices"
+	"strings"
 	"text/template"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
 )
 
 //go:embed templates/rclone_deployment.yml.tmpl
@@ -16,49 +26,323 @@ type RcloneBaseProvider struct {
 	BaseProvider
 	RcloneCommand string
 	RcloneArgs    []string
+
+	// SupportsTLS is set if the server can be served over TLS
+	SupportsTLS bool
+
+	// SupportsKeyAuth is set if the server can authenticate clients by SSH keys
+	SupportsKeyAuth bool
+
+	// AlwaysReadOnly is set if the server can't write, the volume is always served read-only
+	AlwaysReadOnly bool
+
+	// MountSubDir is the directory below the served directory the volume is mounted at, empty to serve the volume itself
+	MountSubDir string
+
+	// Credentials returns the environment variables passing the password to the server, nil if it has no password
+	Credentials func(username string, password string) map[string]string
+
+	// serverCert is generated during deployment if TLS is enabled
+	serverCert *ServerCertificate
+
+	// authorizedKeys are the public keys accepted by the server if key authentication is used
+	authorizedKeys string
+}
+
+// containerFileDir is the directory in the server container files passed in the secret are written to
+const containerFileDir = "/tmp"
+
+// containerDataDir is the directory served by rclone in the server container
+const containerDataDir = "/data"
+
+// ephemeralPidFile records the pid of the server in an ephemeral container, cleanup stops exactly this process
+const ephemeralPidFile = containerFileDir + "/rclone.pid"
+
+// volumeMountPath returns the path the volume is mounted at in the server container
+func (p *RcloneBaseProvider) volumeMountPath() string {
+	return path.Join(containerDataDir, p.MountSubDir)
+}
+
+// containerFile is a file of the server container, its content is passed in the secret
+type containerFile struct {
+	env  string
+	path string
 }
 
 // Deploy creates the necessary Kubernetes resources for an Rclone-based provider
 func (p *RcloneBaseProvider) Deploy() error {
+	client, err := p.GetKubeClient()
+	if err != nil {
+		return err
+	}
+
+	// Record the effective namespace so that later commands don't depend on the kubeconfig default
+	if p.Metadata.Namespace == "" {
+		p.Metadata.Namespace = client.Namespace
+	}
+
+	port := p.Metadata.LocalPort
+	logPath := p.GetLogFilePath()
+
+	if err := os.MkdirAll(p.Metadata.ConfigDir, 0755); err != nil {
+		return fmt.Errorf("error creating temp directory: %v", err)
+	}
+
+	if p.AlwaysReadOnly {
+		p.Metadata.ReadOnly = true
+	}
+	if p.Metadata.TLS && !p.SupportsTLS {
+		p.Metadata.TLS = false
+	}
+	if p.Metadata.TLS {
+		if err := p.generateServerCertificate(); err != nil {
+			return err
+		}
+	}
+
+	if !p.SupportsKeyAuth {
+		p.Metadata.SFTPAuth = ""
+	}
+	if err := p.loadAuthorizedKeys(); err != nil {
+		return err
+	}
+
+	if p.Metadata.AttachPod != "" {
+		err = p.deployEphemeralContainer(client)
+	} else {
+		err = p.deployManifest(client)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Save metadata, the port forwarding daemon reads it
+	if err := p.Metadata.Save(); err != nil {
+		return fmt.Errorf("error saving metadata: %v", err)
+	}
+
+	// Start port forwarding
+	fmt.Printf("Starting port forwarding on port %d...\n", port)
+	pid, err := StartPortForwarding(p.Metadata, logPath)
+	if err != nil {
+		return fmt.Errorf("error starting port forwarding: %v", err)
+	}
+	p.Metadata.PortForwardingPid = pid
+	err = p.Metadata.Save()
+	if err != nil {
+		return fmt.Errorf("error saving metadata: %v", err)
+	}
+
+	// Check if port is reachable
+	if CheckHostPort("127.0.0.1", port, 2000) == false {
+		fmt.Printf("Warning: LocalPort %d does not seem to be reachable\n", port)
+		fmt.Println("Attempting to continue anyway...")
+	} else {
+		fmt.Printf("LocalPort %d is reachable.\n", port)
+	}
+
+	return nil
+}
+
+// generateServerCertificate creates the server certificate and stores the CA certificate for the clients
+func (p *RcloneBaseProvider) generateServerCertificate() error {
+	hosts := []string{"127.0.0.1", "::1", "localhost"}
+	if p.Metadata.LocalHostname != "" && !slices.Contains(hosts, p.Metadata.LocalHostname) {
+		hosts = append(hosts, p.Metadata.LocalHostname)
+	}
+
+	cert, err := GenerateServerCertificate(p.Metadata.ProvisionerName, hosts)
+	if err != nil {
+		return fmt.Errorf("error generating server certificate: %v", err)
+	}
+	if err := os.WriteFile(p.Metadata.GetCACertFilePath(), cert.CACert, 0644); err != nil {
+		return fmt.Errorf("error writing CA certificate: %v", err)
+	}
+
+	p.serverCert = cert
+	return nil
+}
+
+// loadAuthorizedKeys generates a key pair or reads the keys of the ssh-agent, depending on the authentication method
+func (p *RcloneBaseProvider) loadAuthorizedKeys() error {
+	var err error
+	switch p.Metadata.SFTPAuth {
+	case SFTPAuthKey:
+		p.authorizedKeys, err = GenerateSSHKey(p.Metadata.GetSSHKeyFilePath(), p.Metadata.ProvisionerName)
+		if err != nil {
+			return fmt.Errorf("error generating SSH key: %v", err)
+		}
+	case SFTPAuthAgent:
+		p.authorizedKeys, err = GetAgentAuthorizedKeys()
+		if err != nil {
+			return fmt.Errorf("error reading keys from ssh-agent: %v", err)
+		}
+	}
+	return nil
+}
+
+// usesKeyAuth checks if clients are authenticated by SSH keys instead of the password
+func (p *RcloneBaseProvider) usesKeyAuth() bool {
+	return p.Metadata.SFTPAuth == SFTPAuthKey || p.Metadata.SFTPAuth == SFTPAuthAgent
+}
+
+// buildCommand returns the command of the rclone server container
+func (p *RcloneBaseProvider) buildCommand() []string {
+	commandArgs := append([]string{"rclone", "serve", p.RcloneCommand}, p.RcloneArgs...)
+	commandArgs = append(commandArgs, containerDataDir, "--addr", fmt.Sprintf(":%d", p.Metadata.RemotePort))
+	if p.Metadata.ReadOnly {
+		commandArgs = append(commandArgs, "--read-only")
+	}
+
+	// rclone reads certificates and keys from files, they are passed in the secret and written at startup.
+	// This works for ephemeral containers as well, which can't mount additional volumes.
+	var files []containerFile
+	if p.Metadata.TLS {
+		certFile := containerFile{env: "TLS_CERT", path: path.Join(containerFileDir, "tls.crt")}
+		keyFile := containerFile{env: "TLS_KEY", path: path.Join(containerFileDir, "tls.key")}
+		files = append(files, certFile, keyFile)
+		commandArgs = append(commandArgs, "--cert", certFile.path, "--key", keyFile.path)
+	}
+	if p.usesKeyAuth() {
+		keysFile := containerFile{env: "AUTHORIZED_KEYS", path: path.Join(containerFileDir, "authorized_keys")}
+		files = append(files, keysFile)
+		commandArgs = append(commandArgs, "--authorized-keys", keysFile.path)
+	}
+
+	if len(files) > 0 {
+		script := "umask 077"
+		for _, file := range files {
+			script += fmt.Sprintf(` && printf '%%s' "$%s" > %s`, file.env, file.path)
+		}
+		script += ` && exec "$@"`
+		commandArgs = append([]string{"sh", "-c", script, "rclone"}, commandArgs...)
+	}
+
+	return commandArgs
+}
+
+// buildCredentials returns the credentials of the server as environment variables, nil if the server has no auth.
+// rclone reads every flag from an RCLONE_<FLAG> variable, so they don't show up in the pod spec or process list.
+func (p *RcloneBaseProvider) buildCredentials() (map[string]string, error) {
+	var credentials map[string]string
+
+	if p.usesKeyAuth() {
+		credentials = map[string]string{"AUTHORIZED_KEYS": p.authorizedKeys}
+	} else if p.Credentials != nil {
+		password, err := p.Metadata.GetDecodedPassword()
+		if err != nil {
+			return nil, fmt.Errorf("error decoding password: %v", err)
+		}
+		credentials = p.Credentials(p.Metadata.MountUsername, password)
+	}
+
+	if p.Metadata.TLS {
+		if p.serverCert == nil {
+			return nil, fmt.Errorf("server certificate has not been generated")
+		}
+		if credentials == nil {
+			credentials = map[string]string{}
+		}
+		credentials["TLS_CERT"] = string(p.serverCert.Cert)
+		credentials["TLS_KEY"] = string(p.serverCert.Key)
+	}
+
+	return credentials, nil
+}
+
+// deployManifest creates a deployment and service running the rclone server
+func (p *RcloneBaseProvider) deployManifest(client *KubeClient) error {
 	pvcName := p.Metadata.PVCName
 	namespace := p.Metadata.Namespace
-	port := p.Metadata.LocalPort
 	provisionerName := p.Metadata.ProvisionerName
-	username := p.Metadata.MountUsername
-	password, err := p.Metadata.GetDecodedPassword()
+	manifestPath := p.GetManifestPath()
+
+	// ReadWriteOnce volumes that are in use can only be mounted on the same node
+	placement, err := client.GetPVCPlacement(pvcName, namespace)
 	if err != nil {
-		return fmt.Errorf("error decoding password: %v", err)
+		return fmt.Errorf("error determining placement for PVC %s: %v", pvcName, err)
 	}
-	manifestPath := p.GetManifestPath()
-	logPath := p.GetLogFilePath()
+	if placement.NodeName != "" {
+		fmt.Printf("PVC %s is attached to node %s, scheduling %s server on the same node...\n", pvcName, placement.NodeName, p.RcloneCommand)
+	}
+	p.Metadata.NodeName = placement.NodeName
 
-	// Build command and args for the container
-	commandArgs := append([]string{"rclone", "serve", p.RcloneCommand}, p.RcloneArgs...)
-	commandArgs = append(commandArgs, "/data", "--addr", fmt.Sprintf(":%d", p.Metadata.RemotePort))
+	// Build command and args for the container, credentials are passed in a secret
+	commandArgs := p.buildCommand()
+	credentials, err := p.buildCredentials()
+	if err != nil {
+		return err
+	}
 
-	// Add auth parameters if supported by this provider type
-	if p.RcloneCommand == "webdav" || p.RcloneCommand == "http" {
-		commandArgs = append(commandArgs, "--user", username, "--pass", password)
+	// A server that expires is owned by its lease and garbage collected with it.
+	// Renewals update the expiry on the deployment, it isn't part of the pod template.
+	annotations := ManagedAnnotations(p.Metadata)
+	deploymentAnnotations := ManagedAnnotations(p.Metadata)
+	var owners []metav1.OwnerReference
+	if p.Metadata.HasLease() {
+		expiry := p.Metadata.GetExpiry(time.Now())
+		owner, err := client.ApplyLease(p.Metadata, expiry)
+		if err != nil {
+			return fmt.Errorf("error creating lease: %v", err)
+		}
+		owners = append(owners, *owner)
+		deploymentAnnotations[ExpiresAtAnnotation] = expiry.UTC().Format(time.RFC3339)
+		fmt.Printf("The %s server expires at %s unless it is renewed\n", p.RcloneCommand, expiry.Local().Format(time.RFC1123))
 	}
 
 	// Create manifest from template
+	pod := p.Metadata.Pod
 	tmplData := struct {
-		ProvisionerName string
-		Command         string
-		ContainerPort   int
-		PVCName         string
-		Namespace       string
-		RemotePort      int
+		ProvisionerName       string
+		Command               string
+		Secret                bool
+		ContainerPort         int
+		PVCName               string
+		Namespace             string
+		RemotePort            int
+		NodeName              string
+		Tolerations           []corev1.Toleration
+		ReadOnly              bool
+		SubPath               string
+		MountPath             string
+		Image                 string
+		ImagePullSecrets      []corev1.LocalObjectReference
+		Resources             corev1.ResourceRequirements
+		NodeSelector          map[string]string
+		PodSecurityContext    *corev1.PodSecurityContext
+		SecurityContext       *corev1.SecurityContext
+		NetworkPolicy         bool
+		Labels                map[string]string
+		Annotations           map[string]string
+		DeploymentAnnotations map[string]string
+		Owners                []metav1.OwnerReference
 	}{
-		ProvisionerName: provisionerName,
-		Command:         formatStringArray(commandArgs),
-		ContainerPort:   p.Metadata.RemotePort,
-		PVCName:         pvcName,
-		Namespace:       namespace,
+		ProvisionerName:       provisionerName,
+		Command:               formatStringArray(commandArgs),
+		Secret:                credentials != nil,
+		ContainerPort:         p.Metadata.RemotePort,
+		PVCName:               pvcName,
+		Namespace:             namespace,
+		NodeName:              placement.NodeName,
+		Tolerations:           append(placement.Tolerations, pod.Tolerations...),
+		ReadOnly:              p.Metadata.ReadOnly,
+		SubPath:               p.Metadata.SubPath,
+		MountPath:             p.volumeMountPath(),
+		Image:                 pod.GetImage(),
+		ImagePullSecrets:      pod.GetImagePullSecrets(),
+		Resources:             pod.Resources,
+		NodeSelector:          pod.NodeSelector,
+		PodSecurityContext:    pod.PodSecurityContext(),
+		SecurityContext:       pod.ContainerSecurityContext(),
+		NetworkPolicy:         p.Metadata.NetworkPolicy,
+		Labels:                ManagedLabels(p.Metadata),
+		Annotations:           annotations,
+		DeploymentAnnotations: deploymentAnnotations,
+		Owners:                owners,
 	}
 
 	// Parse embedded template
-	tmpl, err := template.New("rclone_deployment").Parse(rcloneDeploymentTemplate)
+	tmpl, err := template.New("rclone_deployment").Funcs(templateFuncs).Parse(rcloneDeploymentTemplate)
 	if err != nil {
 		return fmt.Errorf("error parsing embedded template: %v", err)
 	}
@@ -69,55 +353,178 @@ func (p *RcloneBaseProvider) Deploy() error {
 		return fmt.Errorf("error executing template: %v", err)
 	}
 
-	// Write manifest to file
-	if err := os.MkdirAll(p.Metadata.ConfigDir, 0755); err != nil {
-		return fmt.Errorf("error creating temp directory: %v", err)
+	// The credentials are applied separately, the manifest kept in the config directory must not contain them
+	if credentials != nil {
+		if err := client.ApplySecret(provisionerName, namespace, credentials, ManagedLabels(p.Metadata), nil); err != nil {
+			return fmt.Errorf("error creating credentials secret: %v", err)
+		}
 	}
-	if err := os.WriteFile(manifestPath, manifestBuf.Bytes(), 0644); err != nil {
+
+	// Write manifest to file
+	if err := os.WriteFile(manifestPath, manifestBuf.Bytes(), 0600); err != nil {
 		return fmt.Errorf("error writing manifest file: %v", err)
 	}
 
 	// Apply manifest
-	if err := ApplyManifest(manifestPath); err != nil {
+	if err := client.ApplyManifest(manifestPath); err != nil {
 		return fmt.Errorf("error applying manifest: %v", err)
 	}
 
+	// The secret is garbage collected with the deployment, even if cleanup doesn't run
+	if credentials != nil {
+		deployment, err := client.GetDeployment(provisionerName, namespace)
+		if err != nil {
+			return err
+		}
+		owner := OwnerReferenceFor(deployment, appsv1.SchemeGroupVersion.WithKind("Deployment"))
+		if err := client.SetSecretOwner(provisionerName, namespace, owner); err != nil {
+			return err
+		}
+	}
+
 	// Wait for deployment to be ready
 	fmt.Printf("Waiting for %s server for %s to be ready...\n", p.RcloneCommand, pvcName)
-	if err := WaitForDeployment(provisionerName, namespace, 60); err != nil {
+	if err := client.WaitForDeployment(provisionerName, namespace, 60); err != nil {
+		if !errors.Is(err, ErrTimeout) {
+			return fmt.Errorf("error waiting for %s server: %v", p.RcloneCommand, err)
+		}
 		fmt.Printf("Warning: Timeout waiting for %s server: %v\n", p.RcloneCommand, err)
 
-		// Show logs for debugging
-		logs, logErr := GetPodLogs(fmt.Sprintf("app=%s", provisionerName), p.Metadata.Namespace)
+		// Show warnings and logs for debugging
+		warnings, warnErr := client.GetPodWarnings(fmt.Sprintf("app=%s", provisionerName), namespace)
+		if warnErr == nil && len(warnings) > 0 {
+			fmt.Printf("Pod warnings:\n  %s\n", strings.Join(warnings, "\n  "))
+		}
+		logs, logErr := client.GetPodLogs(fmt.Sprintf("app=%s", provisionerName), namespace)
 		if logErr == nil {
 			fmt.Printf("Pod logs:\n%s\n", logs)
 		}
 		fmt.Println("Attempting to continue anyway...")
 	}
 
-	// Start port forwarding
-	fmt.Printf("Starting port forwarding on port %d...\n", port)
-	pid, err := StartPortForwarding(provisionerName, p.Metadata.Namespace, port, p.Metadata.RemotePort, logPath)
+	return nil
+}
+
+// deployEphemeralContainer injects the rclone server as ephemeral container into the pod given by AttachPod.
+// The container mounts the PVC volume of the pod, so ReadWriteOnce volumes in use can be served as well.
+func (p *RcloneBaseProvider) deployEphemeralContainer(client *KubeClient) error {
+	pvcName := p.Metadata.PVCName
+	namespace := p.Metadata.Namespace
+	podName := p.Metadata.AttachPod
+
+	pod, err := client.GetPod(podName, namespace)
 	if err != nil {
-		return fmt.Errorf("error starting port forwarding: %v", err)
+		return err
 	}
-	p.Metadata.PortForwardingPid = pid
-	err = p.Metadata.Save()
+	volumeName, err := GetPVCVolumeMount(pod, pvcName)
+	if err != nil {
+		return err
+	}
+	p.Metadata.NodeName = pod.Spec.NodeName
+
+	// The container shares the network namespace of the pod
+	p.Metadata.RemotePort = GetFreePodPort(pod, p.Metadata.RemotePort)
+
+	// The server runs in its own process namespace, the pid file keeps cleanup from signalling anything else
+	commandArgs := append([]string{"sh", "-c", fmt.Sprintf(`echo $$ > %s && exec "$@"`, ephemeralPidFile), "rclone"}, p.buildCommand()...)
+	credentials, err := p.buildCredentials()
 	if err != nil {
+		return err
+	}
+
+	// Ephemeral containers run in the existing pod, only container level options apply
+	options := p.Metadata.Pod
+	if len(options.Resources.Requests) > 0 || len(options.Resources.Limits) > 0 || len(options.Tolerations) > 0 ||
+		len(options.NodeSelector) > 0 || len(options.ImagePullSecrets) > 0 || options.FSGroup != nil {
+		fmt.Println("Warning: Resources, tolerations, node selector, image pull secrets and fsGroup are ignored when attaching to a pod")
+	}
+	// the network policies of a pod we don't own are left alone
+	p.Metadata.NetworkPolicy = false
+
+	// Ephemeral containers can't be removed, a unique name allows attaching again later
+	suffix, err := GenerateRandomString(5)
+	if err != nil {
+		return fmt.Errorf("error generating container name: %v", err)
+	}
+	containerName := strings.TrimRight(truncate(p.Metadata.ProvisionerName, 57), "-") + "-" + strings.ToLower(suffix)
+
+	// No target container: sharing its process namespace would make the application PID 1 of the server container
+	container := corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:            containerName,
+			Image:           options.GetImage(),
+			Command:         commandArgs,
+			SecurityContext: options.ContainerSecurityContext(),
+			VolumeMounts: []corev1.VolumeMount{{
+				Name:      volumeName,
+				MountPath: p.volumeMountPath(),
+				SubPath:   p.Metadata.SubPath,
+				ReadOnly:  p.Metadata.ReadOnly,
+			}},
+		},
+	}
+
+	// The secret is garbage collected with the pod, even if cleanup doesn't run
+	if credentials != nil {
+		owner := OwnerReferenceFor(pod, corev1.SchemeGroupVersion.WithKind("Pod"))
+		if err := client.ApplySecret(p.Metadata.ProvisionerName, namespace, credentials, ManagedLabels(p.Metadata), &owner); err != nil {
+			return fmt.Errorf("error creating credentials secret: %v", err)
+		}
+		container.EnvFrom = []corev1.EnvFromSource{{
+			SecretRef: &corev1.SecretEnvSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: p.Metadata.ProvisionerName},
+			},
+		}}
+	}
+
+	fmt.Printf("Attaching %s server to pod %s...\n", p.RcloneCommand, podName)
+	if err := client.AddEphemeralContainer(podName, namespace, container); err != nil {
+		return fmt.Errorf("error adding ephemeral container: %v", err)
+	}
+
+	// Save right away, so that cleanup can stop the container if it doesn't come up
+	p.Metadata.AttachContainer = containerName
+	if err := p.Metadata.Save(); err != nil {
 		return fmt.Errorf("error saving metadata: %v", err)
 	}
 
-	// Check if port is reachable
-	if CheckHostPort("127.0.0.1", port, 2000) == false {
-		fmt.Printf("Warning: LocalPort %d does not seem to be reachable\n", port)
-		fmt.Println("Attempting to continue anyway...")
-	} else {
-		fmt.Printf("LocalPort %d is reachable.\n", port)
+	fmt.Printf("Waiting for %s server in pod %s to be ready...\n", p.RcloneCommand, podName)
+	if err := client.WaitForEphemeralContainer(podName, namespace, containerName, 60); err != nil {
+		return fmt.Errorf("error waiting for %s server: %v", p.RcloneCommand, err)
 	}
 
 	return nil
 }
 
+// templateFuncs are available in the manifest templates
+var templateFuncs = template.FuncMap{
+	"toYaml": toYaml,
+	"indent": indent,
+}
+
+// toYaml renders a value as YAML for embedding into a manifest
+func toYaml(value any) (string, error) {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// indent prefixes every line of a text with the given number of spaces
+func indent(spaces int, text string) string {
+	prefix := strings.Repeat(" ", spaces)
+	return prefix + strings.ReplaceAll(text, "\n", "\n"+prefix)
+}
+
+// truncate shortens a string to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
 // Helper function to format a string array for the manifest
 func formatStringArray(arr []string) string {
 	result := "["
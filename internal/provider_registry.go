@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"sort"
+)
+
+// DefaultRemotePort is the port of the server in the pod if the provider doesn't declare one
+const DefaultRemotePort = 8090
+
+// ProviderDefinition declares a provider. Every provider registers its definition with RegisterProvider,
+// the server deployment, mounting and the rclone config of the clients are derived from it.
+type ProviderDefinition struct {
+	// Name is the provider type selected with -provider, it is the name of the remote in the rclone config as well
+	Name string
+
+	// RcloneCommand is the rclone serve command running the server
+	RcloneCommand string
+
+	// RcloneArgs returns additional arguments of the server, optional
+	RcloneArgs func(metadata *Metadata) []string
+
+	// RemotePort is the port of the server in the pod, DefaultRemotePort if not set
+	RemotePort int
+
+	// SupportsTLS is set if the server can be served over TLS
+	SupportsTLS bool
+
+	// SupportsKeyAuth is set if the server can authenticate clients by SSH keys
+	SupportsKeyAuth bool
+
+	// AlwaysReadOnly is set if the server can't write, the volume is always served read-only
+	AlwaysReadOnly bool
+
+	// MountSubDir returns the directory below the served directory the volume is mounted at, optional
+	MountSubDir func(metadata *Metadata) string
+
+	// Credentials returns the environment variables passing the username and password to the server,
+	// nil if the server doesn't authenticate by password
+	Credentials func(username string, password string) map[string]string
+
+	// Mounters are the names of the mounters that can mount the volume in order of preference, none if it can't be mounted
+	Mounters []string
+
+	// RcloneConfig returns the section of the rclone config for clients, nil if rclone can't connect to the server
+	RcloneConfig func(metadata *Metadata) (string, error)
+
+	// Prepare is called before the server is deployed, optional
+	Prepare func(metadata *Metadata) error
+
+	// Probe checks that the server responds to its protocol through the forwarded port, optional
+	Probe func(metadata *Metadata) error
+
+	// Endpoint returns the address clients other than rclone connect to, it is shown by list, optional
+	Endpoint func(metadata *Metadata) string
+
+	// PrintEndpoint prints the endpoint and the credentials for clients other than rclone after forwarding, optional
+	PrintEndpoint func(metadata *Metadata) error
+}
+
+// providers are the registered providers by name
+var providers = map[string]*ProviderDefinition{}
+
+// RegisterProvider adds a provider, it is called from init of the provider
+func RegisterProvider(definition ProviderDefinition) {
+	if _, exists := providers[definition.Name]; exists {
+		panic("provider " + definition.Name + " is registered twice")
+	}
+	providers[definition.Name] = &definition
+}
+
+// LookupProvider returns the definition of a provider, nil if it doesn't exist
+func LookupProvider(name string) *ProviderDefinition {
+	return providers[name]
+}
+
+// ProviderNames returns the names of the registered providers, only those that can be mounted if mountable is set
+func ProviderNames(mountable bool) []string {
+	var names []string
+	for name, definition := range providers {
+		if !mountable || definition.Mountable() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Mountable checks if the volume can be mounted, otherwise it is only forwarded
+func (d *ProviderDefinition) Mountable() bool {
+	return len(d.Mounters) > 0
+}
+
+// GetRemotePort returns the port of the server in the pod
+func (d *ProviderDefinition) GetRemotePort() int {
+	if d.RemotePort == 0 {
+		return DefaultRemotePort
+	}
+	return d.RemotePort
+}
+
+// GetMountSubDir returns the directory below the served directory the volume is mounted at, empty for the served directory
+func (d *ProviderDefinition) GetMountSubDir(metadata *Metadata) string {
+	if d.MountSubDir == nil {
+		return ""
+	}
+	return d.MountSubDir(metadata)
+}
+
+// passwordCredentials passes the username and password to servers reading the --user and --pass flags
+func passwordCredentials(username string, password string) map[string]string {
+	return map[string]string{
+		"RCLONE_USER": username,
+		"RCLONE_PASS": password,
+	}
+}
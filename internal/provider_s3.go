@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+func init() {
+	RegisterProvider(ProviderDefinition{
+		Name:          "s3",
+		RcloneCommand: "s3",
+		SupportsTLS:   true,
+		// rclone serves every directory of the served path as bucket
+		MountSubDir:  (*Metadata).GetS3Bucket,
+		Credentials:  s3Credentials,
+		Mounters:     []string{RcloneMounterName},
+		RcloneConfig: s3RcloneConfig,
+		// requests are signed with AWS signatures instead of basic auth, any response shows that the server is up
+		Probe: func(metadata *Metadata) error {
+			return probeHTTP(metadata, http.MethodGet, 0)
+		},
+		Endpoint:      s3Endpoint,
+		PrintEndpoint: printS3Endpoint,
+	})
+}
+
+// s3Endpoint returns the endpoint URL and the bucket of an S3 server
+func s3Endpoint(metadata *Metadata) string {
+	return fmt.Sprintf("%s (bucket %s)", strings.TrimSuffix(metadata.GetURL(), "/"), metadata.GetS3Bucket())
+}
+
+// printS3Endpoint prints the endpoint and credentials of an S3 server for aws-cli and other S3 clients
+func printS3Endpoint(metadata *Metadata) error {
+	secretAccessKey, err := metadata.GetDecodedPassword()
+	if err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimSuffix(metadata.GetURL(), "/")
+
+	fmt.Printf("S3 endpoint: %s\n", endpoint)
+	fmt.Printf("S3 bucket: %s\n", metadata.GetS3Bucket())
+	fmt.Printf("S3 access key ID: %s\n", metadata.MountUsername)
+	fmt.Printf("S3 secret access key: %s\n", secretAccessKey)
+
+	caBundle := ""
+	if metadata.TLS {
+		caBundle = " --ca-bundle " + metadata.GetCACertFilePath()
+	}
+	fmt.Printf("Example: AWS_ACCESS_KEY_ID=%s AWS_SECRET_ACCESS_KEY=%s aws --endpoint-url %s%s s3 ls s3://%s\n",
+		metadata.MountUsername, secretAccessKey, endpoint, caBundle, metadata.GetS3Bucket())
+	return nil
+}
+
+// GetS3Bucket returns the name of the bucket the volume is served as
+func (m *Metadata) GetS3Bucket() string {
+	return m.PVCName
+}
+
+// s3Credentials passes the username and password as access key ID and secret access key. rclone reads
+// repeatable flags from CSV encoded variables, the comma of the key pair has to be quoted.
+func s3Credentials(username string, password string) map[string]string {
+	return map[string]string{
+		"RCLONE_AUTH_KEY": `"` + username + "," + password + `"`,
+	}
+}
+
+// s3RcloneConfig returns the rclone remote of an S3 server
+func s3RcloneConfig(metadata *Metadata) (string, error) {
+	password, err := metadata.GetDecodedPassword()
+	if err != nil {
+		return "", fmt.Errorf("failed to decode password: %v", err)
+	}
+
+	content := fmt.Sprintf(`[s3]
+type = s3
+provider = Rclone
+endpoint = %s
+access_key_id = %s
+secret_access_key = %s
+use_multipart_uploads = false
+`, strings.TrimSuffix(metadata.GetURL(), "/"), metadata.MountUsername, password)
+	if metadata.TLS {
+		// only trust the CA generated for this mount
+		content += fmt.Sprintf("override.ca_cert = %s\n", metadata.GetCACertFilePath())
+	}
+	return content, nil
+}
@@ -2,75 +2,44 @@ package internal
 
 import (
 	"fmt"
-	"os/exec"
 )
 
-// SFTPProvider implements the VolumeProvider interface for SFTP
-type SFTPProvider struct {
-	RcloneBaseProvider
-}
-
-// NewSFTPProvider creates a new SFTP provider
-func NewSFTPProvider(metadata *Metadata) *SFTPProvider {
-	passw, err := metadata.GetDecodedPassword()
-	if err != nil {
-		fmt.Printf("Error decoding password: %v", err)
-		return nil
-	}
-
-	return &SFTPProvider{
-		RcloneBaseProvider: RcloneBaseProvider{
-			BaseProvider: BaseProvider{
-				Metadata: metadata,
-			},
-			RcloneCommand: "sftp",
-			RcloneArgs: []string{
-				"--addr=0.0.0.0:" + fmt.Sprintf("%d", metadata.RemotePort),
-				"--user=" + metadata.MountUsername,
-				"--pass=" + passw,
-			},
+func init() {
+	RegisterProvider(ProviderDefinition{
+		Name:            "sftp",
+		RcloneCommand:   "sftp",
+		RemotePort:      2022,
+		SupportsKeyAuth: true,
+		Credentials:     passwordCredentials,
+		Mounters:        []string{RcloneMounterName},
+		RcloneConfig:    sftpRcloneConfig,
+		Probe: func(metadata *Metadata) error {
+			return probeGreeting(metadata, "SSH-2.0-")
 		},
-	}
-}
-
-func (p *SFTPProvider) Name() string {
-	return p.Metadata.ProviderType
-}
-
-func (p *SFTPProvider) GetMounter() (Mounter, error) {
-	if _, err := exec.LookPath("rclone"); err == nil {
-		return NewRcloneMounter(p.Metadata), nil
-	} else {
-		return nil, fmt.Errorf("no SFTP mount method available. Please install rclone")
-	}
+	})
 }
 
-// Mount mounts the SFTP volume to the specified directory
-func (p *SFTPProvider) Mount() error {
-	mounterImpl, err := p.GetMounter()
-	if err != nil {
-		return err
-	}
-	p.Metadata.MountMethod = mounterImpl.Name()
-
-	// Mount the volume
-	fmt.Printf("Using %s...\n", p.Metadata.MountMethod)
-	pid, err := mounterImpl.Mount()
-	if err != nil {
-		return err
+// sftpRcloneConfig returns the rclone remote of an SFTP server, it authenticates by key or password
+func sftpRcloneConfig(metadata *Metadata) (string, error) {
+	content := fmt.Sprintf(`[sftp]
+type = sftp
+hostname = %s
+port = %d
+vendor = other
+user = %s
+`, metadata.LocalHostname, metadata.LocalPort, metadata.MountUsername)
+
+	switch metadata.SFTPAuth {
+	case SFTPAuthKey:
+		content += fmt.Sprintf("key_file = %s\n", metadata.GetSSHKeyFilePath())
+	case SFTPAuthAgent:
+		content += "key_use_agent = true\n"
+	default:
+		obscuredPassword, err := getObscuredPassword(metadata)
+		if err != nil {
+			return "", err
+		}
+		content += fmt.Sprintf("pass = %s\n", obscuredPassword)
 	}
-
-	p.Metadata.MountPid = pid
-
-	// Save metadata
-	if err := p.Metadata.Save(); err != nil {
-		return fmt.Errorf("error saving metadata: %v", err)
-	}
-
-	return nil
-}
-
-// Cleanup unmounts the volume and removes all resources
-func (p *SFTPProvider) Cleanup() error {
-	return p.CleanupResources()
+	return content, nil
 }
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+)
+
+// RemoteServer is a server deployment created by this tool, found in the cluster by its labels
+type RemoteServer struct {
+	Name      string
+	Namespace string
+	PVCName   string
+	SubPath   string
+	Provider  string
+	Client    string
+	CreatedBy string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Version   string
+	Ready     bool
+}
+
+// IsExpired checks if the server outlived its expiry by the given grace period, e.g. because it wasn't garbage collected
+func (s *RemoteServer) IsExpired(grace time.Duration) bool {
+	return !s.ExpiresAt.IsZero() && time.Since(s.ExpiresAt) > grace
+}
+
+// IsOwn checks if the server was created by this client
+func (s *RemoteServer) IsOwn() bool {
+	return s.Client == ClientID()
+}
+
+// newRemoteServer reads the labels and annotations of a server deployment
+func newRemoteServer(deployment *appsv1.Deployment) RemoteServer {
+	labels, annotations := deployment.Labels, deployment.Annotations
+	server := RemoteServer{
+		Name:      deployment.Name,
+		Namespace: deployment.Namespace,
+		PVCName:   annotations[PVCAnnotation],
+		SubPath:   annotations[SubPathAnnotation],
+		Provider:  labels[ProviderLabel],
+		Client:    labels[ClientLabel],
+		CreatedBy: annotations[CreatedByAnnotation],
+		Version:   labels[VersionLabel],
+		Ready:     isDeploymentAvailable(deployment),
+	}
+	if server.PVCName == "" {
+		server.PVCName = labels[PVCLabel]
+	}
+	if server.CreatedBy == "" {
+		server.CreatedBy = server.Client
+	}
+
+	// servers without a TTL or idle timeout don't expire
+	if expiresAt, err := time.Parse(time.RFC3339, annotations[ExpiresAtAnnotation]); err == nil {
+		server.ExpiresAt = expiresAt
+	}
+
+	server.CreatedAt = deployment.CreationTimestamp.Time
+	if createdAt, err := time.Parse(time.RFC3339, annotations[CreatedAtAnnotation]); err == nil {
+		server.CreatedAt = createdAt
+	}
+	return server
+}
+
+// ListRemoteServers returns the servers created by this tool in a namespace, or in all namespaces if namespace is empty.
+// Servers of other clients are included if own isn't set, a non-empty pvcName only returns the servers of this PVC.
+func (c *KubeClient) ListRemoteServers(namespace string, pvcName string, own bool) ([]RemoteServer, error) {
+	selector := ManagedSelector(own)
+	if pvcName != "" {
+		selector += "," + PVCLabel + "=" + toLabelValue(pvcName)
+	}
+
+	var deployments []appsv1.Deployment
+	var err error
+	if namespace != "" {
+		deployments, err = c.ListNamespaceDeployments(selector, namespace)
+	} else {
+		// users that may not list deployments cluster-wide see the namespace of their context
+		deployments, err = c.ListDeployments(selector, []string{c.Namespace})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing servers: %v", err)
+	}
+
+	var servers []RemoteServer
+	for i := range deployments {
+		server := newRemoteServer(&deployments[i])
+		// the label of long PVC names is shortened and may match other PVCs
+		if pvcName != "" && server.PVCName != pvcName {
+			continue
+		}
+		servers = append(servers, server)
+	}
+
+	sort.Slice(servers, func(i, j int) bool {
+		if servers[i].Namespace != servers[j].Namespace {
+			return servers[i].Namespace < servers[j].Namespace
+		}
+		return servers[i].Name < servers[j].Name
+	})
+	return servers, nil
+}
+
+// FindMount returns the local mount of the server in the given context, nil if it isn't mounted from this host
+func (s *RemoteServer) FindMount(mounts []*Metadata, context string) *Metadata {
+	for _, meta := range mounts {
+		if meta.Context == context && meta.Namespace == s.Namespace && meta.ProvisionerName == s.Name {
+			return meta
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// nodeConditionTaintPrefix is the prefix of the taints Kubernetes adds for node conditions, e.g. node.kubernetes.io/not-ready
+const nodeConditionTaintPrefix = "node.kubernetes.io/"
+
+// PVCPlacement describes scheduling constraints for a pod that has to share a PVC with running pods
+type PVCPlacement struct {
+	// NodeName is the node the PVC is attached to, empty if the pod can be scheduled anywhere
+	NodeName string
+
+	// Tolerations for the taints of the node except node conditions, so the pod can run next to the pods already using the PVC
+	Tolerations []corev1.Toleration
+}
+
+// GetPVCPlacement determines where a pod mounting the given PVC can run.
+// ReadWriteOnce volumes can only be attached to a single node, if they are in use a new pod has to run on
+// the same node. An error is returned if the PVC can't be mounted by an additional pod at all.
+func (c *KubeClient) GetPVCPlacement(pvcName string, namespace string) (*PVCPlacement, error) {
+	namespace = c.namespaceOrDefault(namespace)
+	ctx := context.Background()
+
+	pvc, err := c.Clientset.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, pvcName, metav1.GetOptions{})
+	if err != nil {
+		return nil, wrapKubeError(fmt.Sprintf("get pvc %s", pvcName), err)
+	}
+
+	accessModes := pvc.Status.AccessModes
+	if len(accessModes) == 0 {
+		accessModes = pvc.Spec.AccessModes
+	}
+	if slices.Contains(accessModes, corev1.ReadWriteMany) || slices.Contains(accessModes, corev1.ReadOnlyMany) {
+		return &PVCPlacement{}, nil
+	}
+
+	users, err := c.getPVCUsers(pvcName, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return &PVCPlacement{}, nil
+	}
+
+	var podNames []string
+	nodes := map[string]bool{}
+	for _, pod := range users {
+		podNames = append(podNames, pod.Name)
+		nodes[pod.Spec.NodeName] = true
+	}
+
+	if slices.Contains(accessModes, corev1.ReadWriteOncePod) {
+		return nil, fmt.Errorf("PVC %s has access mode ReadWriteOncePod and is already used by pod %s, use -attach to serve it from that pod",
+			pvcName, strings.Join(podNames, ", "))
+	}
+
+	if len(nodes) > 1 {
+		var nodeNames []string
+		for nodeName := range nodes {
+			nodeNames = append(nodeNames, nodeName)
+		}
+		sort.Strings(nodeNames)
+		return nil, fmt.Errorf("PVC %s has access mode ReadWriteOnce but is used by pods on several nodes (%s)",
+			pvcName, strings.Join(nodeNames, ", "))
+	}
+
+	nodeName := users[0].Spec.NodeName
+	node, err := c.Clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if err != nil {
+		return nil, wrapKubeError(fmt.Sprintf("get node %s", nodeName), err)
+	}
+	if node.Spec.Unschedulable {
+		return nil, fmt.Errorf("PVC %s is attached to node %s (used by pod %s), but the node is cordoned",
+			pvcName, nodeName, strings.Join(podNames, ", "))
+	}
+
+	placement := &PVCPlacement{NodeName: nodeName}
+	for _, taint := range node.Spec.Taints {
+		// condition taints like not-ready and unreachable keep their default tolerations, the pod has to be evicted from a failed node
+		if strings.HasPrefix(taint.Key, nodeConditionTaintPrefix) {
+			continue
+		}
+		if taint.Effect == corev1.TaintEffectNoSchedule || taint.Effect == corev1.TaintEffectNoExecute {
+			placement.Tolerations = append(placement.Tolerations, corev1.Toleration{
+				Key:      taint.Key,
+				Operator: corev1.TolerationOpEqual,
+				Value:    taint.Value,
+				Effect:   taint.Effect,
+			})
+		}
+	}
+
+	return placement, nil
+}
+
+// getPVCUsers returns the scheduled pods that mount the given PVC and haven't terminated
+func (c *KubeClient) getPVCUsers(pvcName string, namespace string) ([]corev1.Pod, error) {
+	pods, err := c.Clientset.CoreV1().Pods(namespace).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, wrapKubeError("list pods", err)
+	}
+
+	var users []corev1.Pod
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName == "" || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if podUsesPVC(&pod, pvcName) {
+			users = append(users, pod)
+		}
+	}
+
+	return users, nil
+}
+
+// podUsesPVC checks if a pod mounts the given PVC
+func podUsesPVC(pod *corev1.Pod, pvcName string) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == pvcName {
+			return true
+		}
+	}
+	return false
+}
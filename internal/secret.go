@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	metav1ac "k8s.io/client-go/applyconfigurations/meta/v1"
+)
+
+// OwnerReferenceFor returns an owner reference to the given object, so that it is garbage collected with it
+func OwnerReferenceFor(owner metav1.Object, gvk schema.GroupVersionKind) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: gvk.GroupVersion().String(),
+		Kind:       gvk.Kind,
+		Name:       owner.GetName(),
+		UID:        owner.GetUID(),
+	}
+}
+
+// ApplySecret creates or updates a secret with the given string data and labels using server-side apply
+func (c *KubeClient) ApplySecret(name string, namespace string, data map[string]string, labels map[string]string, owner *metav1.OwnerReference) error {
+	namespace = c.namespaceOrDefault(namespace)
+
+	secret := corev1ac.Secret(name, namespace).WithStringData(data).WithLabels(labels)
+	if owner != nil {
+		secret.WithOwnerReferences(metav1ac.OwnerReference().
+			WithAPIVersion(owner.APIVersion).
+			WithKind(owner.Kind).
+			WithName(owner.Name).
+			WithUID(owner.UID))
+	}
+
+	_, err := c.Clientset.CoreV1().Secrets(namespace).Apply(context.Background(), secret, metav1.ApplyOptions{FieldManager: FieldManager, Force: true})
+	if err != nil {
+		return wrapKubeError(fmt.Sprintf("apply secret %s", name), err)
+	}
+
+	return nil
+}
+
+// SetSecretOwner adds an owner reference to an existing secret without touching its data
+func (c *KubeClient) SetSecretOwner(name string, namespace string, owner metav1.OwnerReference) error {
+	namespace = c.namespaceOrDefault(namespace)
+
+	patch, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"ownerReferences": []metav1.OwnerReference{owner},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Clientset.CoreV1().Secrets(namespace).Patch(context.Background(), name, types.MergePatchType, patch, metav1.PatchOptions{FieldManager: FieldManager})
+	if err != nil {
+		return wrapKubeError(fmt.Sprintf("set owner of secret %s", name), err)
+	}
+
+	return nil
+}
+
+// DeleteSecret deletes a secret, a secret that doesn't exist anymore is not an error
+func (c *KubeClient) DeleteSecret(name string, namespace string) error {
+	namespace = c.namespaceOrDefault(namespace)
+
+	err := c.Clientset.CoreV1().Secrets(namespace).Delete(context.Background(), name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return wrapKubeError(fmt.Sprintf("delete secret %s", name), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,254 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// SessionKey identifies a mount, the same PVC name can be mounted from several namespaces and clusters.
+// Different sub paths of the same PVC are separate mounts.
+type SessionKey struct {
+	Context   string
+	Namespace string
+	PVCName   string
+	SubPath   string
+}
+
+// Key returns the session key of the mount
+func (m *Metadata) Key() SessionKey {
+	return SessionKey{
+		Context:   m.Context,
+		Namespace: m.Namespace,
+		PVCName:   m.PVCName,
+		SubPath:   m.SubPath,
+	}
+}
+
+// String returns a human-readable representation of the key
+func (k SessionKey) String() string {
+	if k.SubPath != "" {
+		return fmt.Sprintf("%s/%s/%s:%s", k.Context, k.Namespace, k.PVCName, k.SubPath)
+	}
+	return fmt.Sprintf("%s/%s/%s", k.Context, k.Namespace, k.PVCName)
+}
+
+// Path returns the relative directory of the session below a base directory.
+// A sub path is appended to the PVC directory name, PVC names can't contain underscores. Sanitizing maps
+// several sub paths to the same name, e.g. a/b and a_b, so a hash of the sub path keeps them apart.
+func (k SessionKey) Path() string {
+	name := k.PVCName
+	if k.SubPath != "" {
+		hash := sha256.Sum256([]byte(k.SubPath))
+		name += "_" + k.SubPath + "-" + hex.EncodeToString(hash[:4])
+	}
+	return filepath.Join(sanitizePathComponent(k.Context), sanitizePathComponent(k.Namespace), sanitizePathComponent(name))
+}
+
+// NormalizeSubPath cleans a sub path of a volume. Like a volumeMount subPath it has to be relative
+// and must not leave the volume. The root of the volume is returned as empty string.
+func NormalizeSubPath(subPath string) (string, error) {
+	if subPath == "" {
+		return "", nil
+	}
+	if filepath.IsAbs(subPath) {
+		return "", fmt.Errorf("sub path %s must be relative", subPath)
+	}
+	for _, element := range strings.Split(subPath, "/") {
+		if element == ".." {
+			return "", fmt.Errorf("sub path %s must not contain '..'", subPath)
+		}
+	}
+
+	subPath = filepath.ToSlash(filepath.Clean(subPath))
+	if subPath == "." {
+		return "", nil
+	}
+	return subPath, nil
+}
+
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// sanitizePathComponent turns an arbitrary name, e.g. an EKS context ARN, into a single directory name
+func sanitizePathComponent(name string) string {
+	name = unsafePathChars.ReplaceAllString(name, "_")
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// FindMetadata loads the metadata of all mounts matching the given PVC name, namespace and context.
+// Empty values match everything. Metadata files that can't be loaded are reported in the returned error,
+// the matching mounts that could be loaded are returned regardless.
+func FindMetadata(pvcName string, namespace string, context string) ([]*Metadata, error) {
+	var result []*Metadata
+	var errs []error
+
+	err := WalkMetadata(func(path string, meta *Metadata, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error loading metadata from %s: %v", path, err))
+			return
+		}
+
+		if (pvcName == "" || meta.PVCName == pvcName) &&
+			(namespace == "" || meta.Namespace == namespace) &&
+			(context == "" || meta.Context == context) {
+			result = append(result, meta)
+		}
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return result, errors.Join(errs...)
+}
+
+// WalkMetadata calls fn for every metadata file of the temp directory with the loaded metadata or the error loading it
+func WalkMetadata(fn func(path string, meta *Metadata, err error)) error {
+	var errs []error
+
+	err := filepath.WalkDir(TempDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == TempDir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipAll
+			}
+			errs = append(errs, err)
+			return nil
+		}
+		if entry.IsDir() || entry.Name() != "config.json" {
+			return nil
+		}
+
+		meta := &Metadata{}
+		if err := meta.Load(path); err != nil {
+			fn(path, nil, err)
+			return nil
+		}
+		fn(path, meta, nil)
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// FindSingleMetadata returns the only mount matching the given PVC name, namespace and context.
+// If the PVC is mounted with several sub paths, the mount with exactly the given sub path is selected.
+func FindSingleMetadata(pvcName string, namespace string, context string, subPath string) (*Metadata, error) {
+	matches, err := FindMetadata(pvcName, namespace, context)
+	if subPath != "" || len(matches) > 1 {
+		var exact []*Metadata
+		for _, meta := range matches {
+			if meta.SubPath == subPath {
+				exact = append(exact, meta)
+			}
+		}
+		if subPath != "" || len(exact) > 0 {
+			matches = exact
+		}
+	}
+	if len(matches) == 0 {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("no mount information found for PVC: %s", pvcName)
+	}
+
+	if len(matches) > 1 {
+		var keys []string
+		for _, meta := range matches {
+			keys = append(keys, meta.Key().String())
+		}
+		return nil, fmt.Errorf("PVC %s is mounted several times, select one with -namespace, -context and -sub-path:\n  %s",
+			pvcName, strings.Join(keys, "\n  "))
+	}
+
+	return matches[0], nil
+}
+
+// MigrateLegacyMetadata moves mounts stored in the former <TempDir>/<pvc> layout to the
+// <TempDir>/<context>/<namespace>/<pvc> layout.
+// The former layout did not record the context, the current kubeconfig context is assumed.
+func MigrateLegacyMetadata() error {
+	legacyFiles, err := filepath.Glob(filepath.Join(TempDir, "*", "config.json"))
+	if err != nil {
+		return err
+	}
+	if len(legacyFiles) == 0 {
+		return nil
+	}
+
+	currentContext, currentNamespace := "", "default"
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{})
+	if rawConfig, err := clientConfig.RawConfig(); err == nil {
+		currentContext = rawConfig.CurrentContext
+	}
+	if namespace, _, err := clientConfig.Namespace(); err == nil && namespace != "" {
+		currentNamespace = namespace
+	}
+
+	var errs []error
+	for _, legacyFile := range legacyFiles {
+		meta := &Metadata{}
+		if err := meta.Load(legacyFile); err != nil {
+			errs = append(errs, fmt.Errorf("error loading metadata from %s: %v", legacyFile, err))
+			continue
+		}
+
+		if meta.Context == "" {
+			meta.Context = currentContext
+		}
+		if meta.Namespace == "" {
+			meta.Namespace = currentNamespace
+		}
+		// keep the mount directory of the former layout
+		if meta.CustomMountDir == "" {
+			meta.CustomMountDir = filepath.Join(MountBaseDir, meta.PVCName)
+		}
+
+		legacyDir := filepath.Dir(legacyFile)
+		newDir := GetConfigDir(meta.Key())
+		if _, err := os.Stat(newDir); err == nil {
+			errs = append(errs, fmt.Errorf("can't migrate %s, %s already exists", legacyDir, newDir))
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(newDir), 0755); err != nil {
+			errs = append(errs, fmt.Errorf("error creating directory: %v", err))
+			continue
+		}
+		if err := os.Rename(legacyDir, newDir); err != nil {
+			errs = append(errs, fmt.Errorf("error moving %s to %s: %v", legacyDir, newDir, err))
+			continue
+		}
+
+		meta.ConfigDir = newDir
+		if err := meta.Save(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Printf("Migrated mount information of PVC %s to %s\n", meta.PVCName, newDir)
+	}
+
+	return errors.Join(errs...)
+}
+
+// removeEmptyParents removes the empty parent directories of path up to, but excluding, base
+func removeEmptyParents(path string, base string) {
+	base = filepath.Clean(base)
+	for dir := filepath.Dir(filepath.Clean(path)); dir != base && strings.HasPrefix(dir, base+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Authentication methods of the SFTP provider
+const (
+	// SFTPAuthPassword uses the generated username and password
+	SFTPAuthPassword = "password"
+
+	// SFTPAuthKey uses an ed25519 key pair generated for the mount
+	SFTPAuthKey = "key"
+
+	// SFTPAuthAgent uses the keys of the local ssh-agent
+	SFTPAuthAgent = "agent"
+)
+
+// ValidateSFTPAuth checks if the given SFTP authentication method is known
+func ValidateSFTPAuth(method string) error {
+	switch method {
+	case SFTPAuthPassword, SFTPAuthKey, SFTPAuthAgent:
+		return nil
+	default:
+		return fmt.Errorf("unknown SFTP authentication method %s, use %s, %s or %s", method, SFTPAuthPassword, SFTPAuthKey, SFTPAuthAgent)
+	}
+}
+
+// GetSSHKeyFilePath returns the path to the private key generated for the mount
+func (m *Metadata) GetSSHKeyFilePath() string {
+	return filepath.Join(m.ConfigDir, "id_ed25519")
+}
+
+// GenerateSSHKey creates an ed25519 key pair, stores the private key in OpenSSH format at path and the
+// public key at path.pub. The public key is returned in authorized_keys format.
+func GenerateSSHKey(path string, comment string) (string, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate key: %v", err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(privateKey, comment)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode private key: %v", err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return "", fmt.Errorf("failed to write private key: %v", err)
+	}
+
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode public key: %v", err)
+	}
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPublicKey))) + " " + comment + "\n"
+	if err := os.WriteFile(path+".pub", []byte(authorizedKey), 0644); err != nil {
+		return "", fmt.Errorf("failed to write public key: %v", err)
+	}
+
+	return authorizedKey, nil
+}
+
+// GetAgentAuthorizedKeys returns the public keys of the local ssh-agent in authorized_keys format
+func GetAgentAuthorizedKeys() (string, error) {
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return "", fmt.Errorf("SSH_AUTH_SOCK is not set, no ssh-agent available")
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to ssh-agent: %v", err)
+	}
+	defer conn.Close()
+
+	keys, err := agent.NewClient(conn).List()
+	if err != nil {
+		return "", fmt.Errorf("failed to list ssh-agent keys: %v", err)
+	}
+	if len(keys) == 0 {
+		return "", fmt.Errorf("the ssh-agent has no keys, add one with ssh-add")
+	}
+
+	var authorizedKeys strings.Builder
+	for _, key := range keys {
+		authorizedKeys.WriteString(strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key))))
+		if key.Comment != "" {
+			authorizedKeys.WriteString(" " + key.Comment)
+		}
+		authorizedKeys.WriteString("\n")
+	}
+
+	return authorizedKeys.String(), nil
+}
@@ -0,0 +1,324 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// SupervisorInterval is the interval in which the supervisor checks port forwarding and mount
+const SupervisorInterval = 5 * time.Second
+
+// MaxRemountAttempts is the number of failed remounts after which the supervisor gives up until the next remount command
+const MaxRemountAttempts = 8
+
+// Supervisor keeps the port forwarding and the local mount of a mount alive.
+// It runs in the background daemon of a mount and reconnects to a new pod after the
+// provider pod was rescheduled, and remounts the volume if the mount process died.
+type Supervisor struct {
+	meta      *Metadata
+	client    *KubeClient
+	forwarder *PortForwarder
+
+	mu            sync.Mutex
+	status        DaemonStatus
+	disconnected  bool
+	mountFailures int
+	watchMount    bool
+	renewedAt     time.Time
+	expired       bool
+	stop          chan struct{}
+	stopOnce      sync.Once
+
+	// remountAttempts counts failed remounts, the next one is delayed until remountAt
+	remountAttempts int
+	remountAt       time.Time
+}
+
+// NewSupervisor creates a supervisor for the given mount
+func NewSupervisor(meta *Metadata) (*Supervisor, error) {
+	client, err := NewKubeClient(meta.KubeOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	var forwarder *PortForwarder
+	if meta.AttachPod != "" {
+		forwarder = NewPodPortForwarder(client, meta.Namespace, meta.AttachPod, meta.LocalPort, meta.RemotePort)
+	} else {
+		forwarder = NewPortForwarder(client, meta.Namespace, fmt.Sprintf("app=%s", meta.ProvisionerName), meta.LocalPort, meta.RemotePort)
+	}
+	// additional ports use the same number locally and in the pod
+	for _, port := range meta.ForwardedPorts {
+		forwarder.AddPort(port, port)
+	}
+
+	s := &Supervisor{
+		meta:       meta,
+		client:     client,
+		forwarder:  forwarder,
+		status:     DaemonStatus{Pid: os.Getpid(), LocalPort: meta.LocalPort},
+		watchMount: true,
+		stop:       make(chan struct{}),
+	}
+	s.forwarder.OnError = s.reportError
+
+	return s, nil
+}
+
+// Run starts port forwarding and supervises it until Stop is called
+func (s *Supervisor) Run() error {
+	// Fail early if the pod can't be reached
+	if _, err := s.forwarder.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to pod: %v", err)
+	}
+	if err := s.forwarder.Listen(s.meta.LocalHostname); err != nil {
+		return err
+	}
+	s.logf("Forwarding %s:%d to pod %s port %d", s.meta.LocalHostname, s.meta.LocalPort, s.forwarder.PodName(), s.meta.RemotePort)
+	if len(s.meta.ForwardedPorts) > 0 {
+		s.logf("Forwarding additional ports %v", s.meta.ForwardedPorts)
+	}
+
+	control, err := ServeControlSocket(s.meta.GetControlSocketPath(), s.handleControlCommand)
+	if err != nil {
+		_ = s.forwarder.Close()
+		return err
+	}
+	defer control.Close()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-signals:
+			s.logf("Received %s, stopping", sig)
+			s.Stop()
+		case <-s.stop:
+		}
+	}()
+
+	go s.watch()
+
+	return s.forwarder.Serve()
+}
+
+// Stop ends supervision and port forwarding
+func (s *Supervisor) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+		_ = s.forwarder.Close()
+	})
+}
+
+func (s *Supervisor) handleControlCommand(command string) (string, error) {
+	switch command {
+	case "status":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.status.Pod = s.forwarder.PodName()
+		data, err := json.Marshal(s.status)
+		return string(data), err
+	case "stop":
+		s.logf("Stop requested")
+		go s.Stop()
+		return "", nil
+	case "detach":
+		// the mount is about to be unmounted on purpose
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.watchMount = false
+		return "", nil
+	case "attach":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.watchMount = true
+		s.remountAttempts = 0
+		s.remountAt = time.Time{}
+		return "", nil
+	default:
+		return "", fmt.Errorf("unknown command: %s", command)
+	}
+}
+
+func (s *Supervisor) reportError(err error) {
+	s.logf("Port forwarding error: %v", err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.LastError = err.Error()
+	s.status.LastErrorAt = time.Now()
+}
+
+func (s *Supervisor) logf(format string, args ...any) {
+	fmt.Printf("%s %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+}
+
+func (s *Supervisor) recordEvent(eventType string, message string) {
+	s.logf("%s: %s", eventType, message)
+	if err := s.meta.RecordEvent(eventType, message); err != nil {
+		s.logf("Warning: failed to record event: %v", err)
+	}
+}
+
+// watch periodically checks port forwarding and mount until the supervisor is stopped
+func (s *Supervisor) watch() {
+	ticker := time.NewTicker(SupervisorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.checkForwarding()
+			s.checkMount()
+			s.renewLease()
+		}
+	}
+}
+
+// checkForwarding reconnects to a ready pod if the current one is gone
+func (s *Supervisor) checkForwarding() {
+	reconnected, err := s.forwarder.EnsureConnected()
+	if err != nil {
+		if !s.disconnected {
+			s.disconnected = true
+			s.recordEvent(EventDisconnected, fmt.Sprintf("lost connection to pod: %v", err))
+		}
+		return
+	}
+
+	if reconnected || s.disconnected {
+		s.disconnected = false
+		s.recordEvent(EventReconnected, fmt.Sprintf("forwarding to pod %s", s.forwarder.PodName()))
+	}
+}
+
+// checkMount remounts the volume if the mount process died or the mount point disappeared.
+// Failed remounts are retried with exponential backoff, up to MaxRemountAttempts times.
+func (s *Supervisor) checkMount() {
+	s.mu.Lock()
+	watchMount, remountAttempts, remountAt := s.watchMount, s.remountAttempts, s.remountAt
+	s.mu.Unlock()
+	if !watchMount {
+		return
+	}
+
+	// the mount command updates the metadata after the daemon was started, so always use the latest state
+	meta := &Metadata{}
+	if err := meta.Load(s.meta.GetConfigFilePath()); err != nil {
+		return
+	}
+	if meta.MountMethod == "" {
+		// port forwarding only, nothing to supervise
+		return
+	}
+
+	mountDir := meta.GetMountDir()
+	mounted := IsMountPoint(mountDir)
+	if mounted && (meta.MountPid == 0 || IsProcessAlive(meta.MountPid)) {
+		s.mountFailures = 0
+		s.setRemountAttempts(0)
+		return
+	}
+
+	// the mount may still be in progress, only act if the failure persists
+	s.mountFailures++
+	if s.mountFailures < 2 || remountAttempts >= MaxRemountAttempts || time.Now().Before(remountAt) {
+		return
+	}
+
+	provider := NewProviderFromMetadata(meta)
+	if provider == nil {
+		return
+	}
+	mounterImpl, err := provider.GetMounter()
+	if err != nil {
+		s.recordEvent(EventMountFailed, fmt.Sprintf("error identifying mounter: %v", err))
+		s.setRemountAttempts(MaxRemountAttempts)
+		return
+	}
+
+	// the daemon has no terminal, e.g. sudo would fail on every attempt
+	if definition := LookupMounter(mounterImpl.Name()); definition != nil && definition.Interactive != nil && definition.Interactive() {
+		s.recordEvent(EventMountFailed, fmt.Sprintf("%s is not mounted, %s can't mount it without a terminal, run remount", mountDir, mounterImpl.Name()))
+		s.setRemountAttempts(MaxRemountAttempts)
+		return
+	}
+
+	if mounted {
+		if err := ForceUnmount(mountDir); err != nil {
+			s.recordEvent(EventMountFailed, fmt.Sprintf("error removing stale mount: %v", err))
+			s.setRemountAttempts(remountAttempts + 1)
+			return
+		}
+	}
+
+	pid, err := mounterImpl.Mount()
+	if err != nil {
+		remountAttempts++
+		if remountAttempts == MaxRemountAttempts {
+			s.recordEvent(EventMountFailed, fmt.Sprintf("error remounting %s, giving up after %d attempts, run remount: %v", mountDir, remountAttempts, err))
+		} else {
+			s.recordEvent(EventMountFailed, fmt.Sprintf("error remounting %s: %v", mountDir, err))
+		}
+		s.setRemountAttempts(remountAttempts)
+		return
+	}
+
+	// only the pid is written, a command may have changed the metadata since it was loaded
+	if err := meta.SaveMountPid(pid); err != nil {
+		s.logf("Warning: failed to save metadata: %v", err)
+	}
+	s.mountFailures = 0
+	s.setRemountAttempts(0)
+	s.recordEvent(EventRemounted, fmt.Sprintf("remounted %s using %s", mountDir, mounterImpl.Name()))
+}
+
+// setRemountAttempts records the number of failed remounts and delays the next one exponentially
+func (s *Supervisor) setRemountAttempts(attempts int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remountAttempts = attempts
+	s.remountAt = time.Time{}
+	if attempts > 0 {
+		s.remountAt = time.Now().Add(SupervisorInterval << attempts)
+	}
+}
+
+// renewLease keeps a server with an idle timeout alive while clients use the forwarded ports.
+// Renewals stop once no connection was open since the last one, so the server expires after the idle timeout.
+func (s *Supervisor) renewLease() {
+	meta := &Metadata{}
+	if err := meta.Load(s.meta.GetConfigFilePath()); err != nil || !meta.HasLease() {
+		return
+	}
+
+	now := time.Now()
+	if meta.TTL > 0 && !now.Before(meta.ExpiresAt) {
+		if !s.expired {
+			s.expired = true
+			s.recordEvent(EventExpired, fmt.Sprintf("the server expired at %s", meta.ExpiresAt.Format(time.RFC3339)))
+		}
+		return
+	}
+	s.expired = false
+
+	// renew well before the idle timeout, a single failed renewal doesn't remove the server
+	if meta.IdleTimeout == 0 || now.Sub(s.renewedAt) < LeaseRenewInterval(meta.IdleTimeout) {
+		return
+	}
+	if !s.forwarder.LastActive().After(s.renewedAt) {
+		// idle since the last renewal, it expires at least the idle timeout after the last connection
+		return
+	}
+	if err := s.client.RenewLease(meta, meta.GetExpiry(now)); err != nil {
+		s.logf("Warning: failed to renew lease: %v", err)
+		return
+	}
+	s.renewedAt = now
+}
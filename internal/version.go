@@ -0,0 +1,17 @@
+package internal
+
+import "runtime/debug"
+
+// Version is the version of the tool, set at build time with -ldflags "-X k8s-volume-mount/internal.Version=v1.2.3"
+var Version = ""
+
+// GetVersion returns the version of the tool, the module version if it was installed with go install, or "dev"
+func GetVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
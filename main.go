@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"k8s-volume-mount/cmd"
 	"k8s-volume-mount/internal"
@@ -30,6 +31,26 @@ func main() {
 		}
 
 	case "unmount":
+		err := cmd.UnmountCommand(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "remount":
+		err := cmd.RemountCommand(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "renew":
+		err := cmd.RenewCommand(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
 	case "cleanup":
 		err := cmd.CleanupCommand(os.Args[2:])
 		if err != nil {
@@ -44,6 +65,23 @@ func main() {
 			os.Exit(1)
 		}
 
+	case "status":
+		err := cmd.StatusCommand(os.Args[2:])
+		if errors.Is(err, cmd.ErrUnhealthy) {
+			os.Exit(cmd.ExitUnhealthy)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(cmd.ExitError)
+		}
+
+	case "doctor":
+		err := cmd.DoctorCommand(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
 	case "forward":
 		err := cmd.ForwardCommand(os.Args[2:])
 		if err != nil {
@@ -51,6 +89,20 @@ func main() {
 			os.Exit(1)
 		}
 
+	case internal.DaemonCommandName:
+		err := cmd.DaemonCommand(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case internal.NFSFuseCommandName:
+		err := cmd.NFSFuseCommand(os.Args[2:])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
 	default:
 		fmt.Printf("Unknown command: %s\n", os.Args[1])
 		printUsage()
@@ -63,13 +115,42 @@ func printUsage() {
 	fmt.Println("\nCommands:")
 	fmt.Println("  mount   -pvc=NAME [-port PORT] [-type TYPE] [-namespace NAMESPACE] [-pause-on-error] [-mount-dir DIR]  Mount a volume")
 	fmt.Println("  forward -pvc=NAME [-port PORT] [-type TYPE] [-namespace NAMESPACE] Forward provider server port to local machine")
-	fmt.Println("  cleanup -pvc=NAME      Unmount a volume and delete associated resources")
-	fmt.Println("  list                   List mounted volumes")
+	fmt.Println("  unmount -pvc=NAME [-namespace NAMESPACE] [-context CONTEXT] [-sub-path PATH] [-stop-forward]  Unmount a volume and keep the server")
+	fmt.Println("  remount -pvc=NAME [-namespace NAMESPACE] [-context CONTEXT] [-sub-path PATH]  Mount an unmounted volume again")
+	fmt.Println("  renew   -pvc=NAME [-namespace NAMESPACE] [-context CONTEXT] [-sub-path PATH] [-ttl DURATION]  Extend the lifetime of a server with a TTL")
+	fmt.Println("  cleanup -pvc=NAME [-namespace NAMESPACE] [-context CONTEXT] [-sub-path PATH] [-remote [-all-clients]]  Unmount a volume and delete associated resources")
+	fmt.Println("  status  -pvc=NAME [-namespace NAMESPACE] [-context CONTEXT] [-sub-path PATH]  Check server, port forwarding, mount and protocol")
+	fmt.Println("  doctor  [-fix]  Find and repair leftovers of crashed mounts: stale mounts, orphaned processes, leaked deployments")
+	fmt.Println("  list    [-pvc NAME] [-namespace NAMESPACE] [-context CONTEXT] [-remote]  List mounted volumes, or the servers in the cluster")
 	fmt.Println("\nOptions:")
 	fmt.Println("  -pvc         Name of the PersistentVolumeClaim")
 	fmt.Println("  -port        Specific port for LocalPort Forward (default: auto-detect)")
-	fmt.Println("  -provider    Mount type: webdav, sftp, nfs (default: webdav)")
+	fmt.Println("  -provider    Mount type: webdav, sftp, nfs, s3, ftp, http (forward only) (default: webdav)")
 	fmt.Println("  -namespace   Namespace (optional)")
 	fmt.Println("  -pause-on-error  Wait for user input on error before cleanup")
-	fmt.Println("  -mount-dir   Mount directory (optional, default: ~/k8s-mounts)")
+	fmt.Println("  -read-only   Serve and mount the volume read-only")
+	fmt.Println("  -sub-path    Only serve this directory of the volume (optional)")
+	fmt.Println("  -sftp-auth   SFTP authentication: password, key or agent (default: password)")
+	fmt.Println("  -tls         Serve over TLS with a certificate generated for the mount (webdav, s3 and http only, default: true)")
+	fmt.Println("  -network-policy  Deny all network traffic to the server pod, port forwarding is not affected (default: true)")
+	fmt.Println("  -attach      Inject the server into a running pod that mounts the PVC instead of creating a deployment")
+	fmt.Println("  -attach-pod  Inject the server into this pod (implies -attach)")
+	fmt.Println("  -mount-dir   Mount directory (optional, default: ~/k8s-mounts/CONTEXT/NAMESPACE/PVC)")
+	fmt.Println("  -ttl         Remove the server after this duration unless it is renewed, e.g. 8h (optional)")
+	fmt.Println("  -idle-timeout  Remove the server if no client connected for this duration, e.g. 30m (optional)")
+	fmt.Println("\nPod options (mount, forward):")
+	fmt.Println("  -pod-config  File with pod options (optional, default: ~/.config/k8s-volume-mount/pod.yaml if it exists)")
+	fmt.Println("  -image       Image of the server (optional, default: rclone/rclone:latest)")
+	fmt.Println("  -image-pull-secret  Image pull secret, can be repeated (optional)")
+	fmt.Println("  -requests    Resource requests, e.g. cpu=100m,memory=128Mi (optional)")
+	fmt.Println("  -limits      Resource limits, e.g. cpu=1,memory=512Mi (optional)")
+	fmt.Println("  -toleration  Toleration KEY[=VALUE][:EFFECT], can be repeated (optional)")
+	fmt.Println("  -node-selector  Node selector KEY=VALUE, can be repeated (optional)")
+	fmt.Println("  -run-as-user, -run-as-group, -fs-group  User and group IDs of the server (optional)")
+	fmt.Println("\nGlobal options (mount, forward, unmount, remount, renew, status, cleanup, doctor, list):")
+	fmt.Println("  -kubeconfig  Path to the kubeconfig file (optional)")
+	fmt.Println("  -context     Kubeconfig context (optional, default: current context)")
+	fmt.Println("  -as          Username to impersonate (optional)")
+	fmt.Println("  -as-group    Group to impersonate, can be repeated (optional)")
+	fmt.Println("\nThe context and identity used for a mount are stored with it and reused by cleanup.")
 }